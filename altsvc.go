@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// altSvc is an HTTP/3 alternative advertised in a response's Alt-Svc
+// header (RFC 7838), e.g. `h3=":443"; ma=86400`.
+type altSvc struct {
+	host   string // alternative host ("" = same as the origin)
+	port   int
+	maxAge time.Duration
+}
+
+// defaultMaxAge applies when an alternative has no ma parameter.
+const defaultMaxAge = 24 * time.Hour
+
+// parseAltSvc returns the first h3 alternative in an Alt-Svc header value.
+// ok is false if there is none, including for "clear". Draft versions
+// (h3-29) are ignored: quic-go only speaks the final protocol.
+func parseAltSvc(v string) (a altSvc, ok bool) {
+	for _, entry := range strings.Split(v, ",") {
+		params := strings.Split(entry, ";")
+		id, authority, found := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !found || id != "h3" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(strings.Trim(authority, `"`))
+		if err != nil {
+			continue
+		}
+		a = altSvc{host: host, maxAge: defaultMaxAge}
+		if a.port, err = strconv.Atoi(port); err != nil || a.port <= 0 || a.port > 65535 {
+			continue
+		}
+		for _, p := range params[1:] {
+			name, val, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if name == "ma" {
+				if secs, err := strconv.ParseInt(strings.Trim(val, `"`), 10, 64); err == nil && secs >= 0 {
+					a.maxAge = time.Duration(secs) * time.Second
+				}
+			}
+		}
+		return a, true
+	}
+	return altSvc{}, false
+}
+
+// authority returns the address to dial for origin (host or host:port).
+func (a altSvc) authority(origin string) string {
+	host := a.host
+	if host == "" {
+		host = origin
+		if h, _, err := net.SplitHostPort(origin); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	return net.JoinHostPort(host, strconv.Itoa(a.port))
+}
+
+// sameOrigin reports whether a points at the origin's own host and port,
+// so HTTP/3 can dial the origin URL as is.
+func (a altSvc) sameOrigin(origin string) bool {
+	if a.host != "" {
+		return false
+	}
+	_, port, err := net.SplitHostPort(origin)
+	if err != nil {
+		port = "443"
+	}
+	return port == strconv.Itoa(a.port)
+}
+
+// String formats a for the header, e.g. "h3 on :443, max-age 24h00m".
+func (a altSvc) String() string {
+	return "h3 on " + a.host + ":" + strconv.Itoa(a.port) + ", max-age " + fmtDuration(a.maxAge)
+}
+
+// noteAltSvc updates t.h3 from a response's Alt-Svc value and reports
+// whether the advertisement changed. Like a browser's alt-svc cache, a
+// response without the header leaves it as is; "clear" or a value with
+// no h3 alternative withdraws it.
+func (t *target) noteAltSvc(v string) bool {
+	if v == "" {
+		return false
+	}
+	a, ok := parseAltSvc(v)
+	if !ok {
+		changed := t.h3 != nil
+		t.h3 = nil
+		return changed
+	}
+	if t.h3 != nil && *t.h3 == a {
+		return false
+	}
+	t.h3 = &a
+	return true
+}
+
+// altSvcText describes t's current advertisement for notices, e.g.
+// "Alt-Svc: h3 on :443, max-age 24h00m".
+func altSvcText(t *target) string {
+	if t.h3 == nil {
+		return "Alt-Svc: h3 no longer advertised"
+	}
+	return "Alt-Svc: " + t.h3.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: Alt-Svc parsing
+// =============================================================================
+
+func TestParseAltSvc_TableDriven(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   altSvc
+		wantOK bool
+	}{
+		{`h3=":443"; ma=86400`, altSvc{port: 443, maxAge: 24 * time.Hour}, true},
+		{`h3=":443"`, altSvc{port: 443, maxAge: defaultMaxAge}, true},
+		{`h2=":443"; ma=60, h3="alt.example.com:8443"; ma=3600; persist=1`, altSvc{host: "alt.example.com", port: 8443, maxAge: time.Hour}, true},
+		{`h3-29=":443"; ma=60, h3=":4433"; ma=60`, altSvc{port: 4433, maxAge: time.Minute}, true},
+		{`h3=":443"; ma=bogus`, altSvc{port: 443, maxAge: defaultMaxAge}, true},
+		{`clear`, altSvc{}, false},
+		{`h3-29=":443"`, altSvc{}, false},
+		{`h3="no-port"`, altSvc{}, false},
+		{`h3=":0"`, altSvc{}, false},
+		{``, altSvc{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseAltSvc(tt.value)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseAltSvc = %+v, %v; want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAltSvc_Authority(t *testing.T) {
+	tests := []struct {
+		a          altSvc
+		origin     string
+		want       string
+		wantSameAs bool
+	}{
+		{altSvc{port: 443}, "example.com", "example.com:443", true},
+		{altSvc{port: 443}, "example.com:8443", "example.com:443", false},
+		{altSvc{port: 8443}, "example.com:8443", "example.com:8443", true},
+		{altSvc{port: 443}, "[::1]:8443", "[::1]:443", false},
+		{altSvc{host: "alt.example.com", port: 443}, "example.com", "alt.example.com:443", false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.authority(tt.origin); got != tt.want {
+			t.Errorf("%+v.authority(%q) = %q; want %q", tt.a, tt.origin, got, tt.want)
+		}
+		if got := tt.a.sameOrigin(tt.origin); got != tt.wantSameAs {
+			t.Errorf("%+v.sameOrigin(%q) = %v; want %v", tt.a, tt.origin, got, tt.wantSameAs)
+		}
+	}
+}
+
+func TestNoteAltSvc_TracksAdvertisement(t *testing.T) {
+	tg := &target{}
+	steps := []struct {
+		value       string
+		wantChanged bool
+		wantPort    int // 0 = not advertised
+	}{
+		{`h3=":443"; ma=60`, true, 443},
+		{``, false, 443}, // no header keeps the cached advertisement
+		{`h3=":443"; ma=60`, false, 443},
+		{`h3=":443"; ma=120`, true, 443},
+		{`clear`, true, 0},
+		{`clear`, false, 0},
+	}
+	for i, st := range steps {
+		if changed := tg.noteAltSvc(st.value); changed != st.wantChanged {
+			t.Errorf("step %d (%q): changed = %v; want %v", i, st.value, changed, st.wantChanged)
+		}
+		port := 0
+		if tg.h3 != nil {
+			port = tg.h3.port
+		}
+		if port != st.wantPort {
+			t.Errorf("step %d (%q): port = %d; want %d", i, st.value, port, st.wantPort)
+		}
+	}
+	if tg.noteAltSvc(`h3=":443"; ma=60`); tg.h3.String() != "h3 on :443, max-age 1m00s" {
+		t.Errorf("String = %q", tg.h3.String())
+	}
+}
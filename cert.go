@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tlsInfo is what a probe's TLS handshake revealed: the negotiated
+// parameters and the certificate chain the server presented. For HTTP/3
+// it comes from the QUIC connection state.
+type tlsInfo struct {
+	version     uint16
+	cipher      uint16
+	alpn        string
+	chain       []string  // subject of each certificate, leaf first
+	notAfter    time.Time // leaf expiry
+	fingerprint string    // SHA-256 of the leaf, hex
+}
+
+// newTLSInfo extracts a tlsInfo from a response's connection state. It
+// returns nil for plain HTTP.
+func newTLSInfo(cs *tls.ConnectionState) *tlsInfo {
+	if cs == nil {
+		return nil
+	}
+	info := &tlsInfo{version: cs.Version, cipher: cs.CipherSuite, alpn: cs.NegotiatedProtocol}
+	for _, c := range cs.PeerCertificates {
+		name := c.Subject.CommonName
+		if name == "" && len(c.DNSNames) > 0 {
+			name = c.DNSNames[0]
+		}
+		info.chain = append(info.chain, name)
+	}
+	if len(cs.PeerCertificates) > 0 {
+		leaf := cs.PeerCertificates[0]
+		sum := sha256.Sum256(leaf.Raw)
+		info.notAfter = leaf.NotAfter
+		info.fingerprint = hex.EncodeToString(sum[:])
+	}
+	return info
+}
+
+// sameHeader reports whether i and j negotiated the same parameters with
+// the same leaf, i.e. would print the same header.
+func (i *tlsInfo) sameHeader(j *tlsInfo) bool {
+	return j != nil && i.version == j.version && i.cipher == j.cipher && i.alpn == j.alpn && i.fingerprint == j.fingerprint
+}
+
+// short is the abbreviated fingerprint shown in messages.
+func (i *tlsInfo) short() string {
+	if len(i.fingerprint) < 12 {
+		return i.fingerprint
+	}
+	return i.fingerprint[:12]
+}
+
+// params formats the negotiated parameters, e.g.
+// "TLS 1.3 TLS_AES_128_GCM_SHA256 h2".
+func (i *tlsInfo) params() string {
+	text := tls.VersionName(i.version) + " " + tls.CipherSuiteName(i.cipher)
+	if i.alpn != "" {
+		text += " " + i.alpn
+	}
+	return text
+}
+
+// describe formats the negotiated parameters and leaf expiry for the
+// header, e.g. "TLS 1.3 TLS_AES_128_GCM_SHA256 h2, cert expires 2027-01-12 (88d)".
+func (i *tlsInfo) describe(now time.Time) string {
+	text := i.params()
+	if !i.notAfter.IsZero() {
+		text += fmt.Sprintf(", cert expires %s (%s)", i.notAfter.Format(time.DateOnly), fmtDays(i.notAfter.Sub(now)))
+	}
+	return text
+}
+
+// certChange is a leaf certificate rotation seen mid-session.
+type certChange struct {
+	at       time.Time
+	from, to *tlsInfo
+}
+
+// recordTLS notes the TLS state of a successful probe, recording a
+// certificate change when the leaf differs from the previous one.
+func recordTLS(s *stats, at time.Time, info *tlsInfo) {
+	if s.tls != nil && info.fingerprint != s.tls.fingerprint {
+		s.certChanges = append(s.certChanges, certChange{at: at, from: s.tls, to: info})
+	}
+	s.tls = info
+}
+
+// rotation returns the certificate change recorded for r, if any.
+func rotation(r result) *certChange {
+	changes := r.t.s.certChanges
+	if r.tls == nil || len(changes) == 0 || changes[len(changes)-1].to != r.tls {
+		return nil
+	}
+	return &changes[len(changes)-1]
+}
+
+// certExpiring reports whether the last seen leaf expires within
+// s.certWarn of now (or already has).
+func certExpiring(s *stats, now time.Time) bool {
+	return s.certWarn > 0 && s.tls != nil && !s.tls.notAfter.IsZero() && s.tls.notAfter.Sub(now) < s.certWarn
+}
+
+// certWarnings returns the stats line's certificate warnings, if any.
+func certWarnings(s *stats, now time.Time) string {
+	var text string
+	if certExpiring(s, now) {
+		color := yellow
+		if !now.Before(s.tls.notAfter) {
+			color = red
+		}
+		text += fmt.Sprintf(" %s[cert expires in %s]%s", color, fmtDays(s.tls.notAfter.Sub(now)), reset)
+	}
+	if n := len(s.certChanges); n > 0 {
+		text += fmt.Sprintf(" %s[cert changed %s]%s", yellow, s.certChanges[n-1].at.Format("15:04:05"), reset)
+	}
+	return text
+}
+
+// certSummary returns the summary lines for the TLS state: the last seen
+// parameters and chain, then any alerts.
+func certSummary(s *stats, now time.Time) []string {
+	if s.tls == nil {
+		return nil
+	}
+	lines := []string{fmt.Sprintf("tls: %s", s.tls.describe(now))}
+	if len(s.tls.chain) > 0 {
+		lines = append(lines, fmt.Sprintf("%schain:%s %s", gray, reset, strings.Join(s.tls.chain, " ← ")))
+	}
+	return append(lines, certAlerts(s, now)...)
+}
+
+// certAlerts returns a line for an expiring leaf and one per rotation.
+func certAlerts(s *stats, now time.Time) []string {
+	var lines []string
+	if certExpiring(s, now) {
+		lines = append(lines, fmt.Sprintf("%s⚠ certificate expires in %s (%s), within --cert-warn %s%s",
+			yellow, fmtDays(s.tls.notAfter.Sub(now)), s.tls.notAfter.Format(time.DateOnly), fmtDays(s.certWarn), reset))
+	}
+	for _, c := range s.certChanges {
+		lines = append(lines, fmt.Sprintf("%s⚠ certificate changed at %s: %s → %s (expires %s)%s",
+			yellow, c.at.Format("15:04:05"), c.from.short(), c.to.short(), c.to.notAfter.Format(time.DateOnly), reset))
+	}
+	return lines
+}
+
+// fmtDays formats a certificate lifetime: whole days when at least one
+// is left, otherwise hours (negative once expired).
+func fmtDays(d time.Duration) string {
+	if d >= 24*time.Hour || d <= -24*time.Hour {
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+	return strconv.Itoa(int(d/time.Hour)) + "h"
+}
+
+// parseCertWarn parses a --cert-warn threshold: whole days ("14d") or a
+// Go duration ("36h"). "0" disables the warning.
+func parseCertWarn(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --cert-warn %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --cert-warn %q (want e.g. 14d or 36h)", v)
+	}
+	return d, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// =============================================================================
+// Test: TLS certificate inspection and expiry warnings
+// =============================================================================
+
+func TestParseCertWarn(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"14d", 14 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"0", 0, false},
+		{"36h", 36 * time.Hour, false},
+		{"1.5d", 0, true},
+		{"-3d", 0, true},
+		{"-1h", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCertWarn(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCertWarn(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNewTLSInfo_HTTPSAndHTTP3(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile, _ := testCert(t, dir, "Test Root", &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	server, _, _ := testCert(t, dir, "leaf.test", &x509.Certificate{DNSNames: []string{"leaf.test"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	server.Certificate = append(server.Certificate, ca.Certificate[0]) // serve the full chain
+
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{server}}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = serverTLS
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = udp.Close() }()
+	h3srv := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(serverTLS)}
+	go func() { _ = h3srv.Serve(udp) }()
+	defer func() { _ = h3srv.Close() }()
+
+	cfg, err := newTLSConfig(tlsSettings{caFile: caFile, sni: "leaf.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &options{timeout: 5 * time.Second, tls: cfg}
+	tests := []struct {
+		proto int
+		url   string
+		alpn  string
+	}{
+		{protoHTTPS, "https://" + srv.Listener.Addr().String(), ""}, // HTTP/1.1 over TLS offers no ALPN
+		{protoHTTP2, "https://" + srv.Listener.Addr().String(), "h2"},
+		{protoHTTP3, "https://" + udp.LocalAddr().String(), "h3"},
+	}
+	if newTLSInfo(nil) != nil {
+		t.Error("newTLSInfo(nil) != nil for plain HTTP")
+	}
+	for _, tt := range tests {
+		m, err := measureRTT(createClient(tt.proto, o), tt.url, tt.proto, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", protoNames[tt.proto], err)
+		}
+		info := m.tls
+		if info == nil {
+			t.Fatalf("%s: no TLS info", protoNames[tt.proto])
+		}
+		if info.version != tls.VersionTLS13 || info.alpn != tt.alpn {
+			t.Errorf("%s: version %x, alpn %q; want TLS 1.3, %q", protoNames[tt.proto], info.version, info.alpn, tt.alpn)
+		}
+		if strings.Join(info.chain, ",") != "leaf.test,Test Root" {
+			t.Errorf("%s: chain = %q", protoNames[tt.proto], info.chain)
+		}
+		if !info.notAfter.Equal(server.Leaf.NotAfter) || len(info.fingerprint) != 64 {
+			t.Errorf("%s: notAfter %v, fingerprint %q", protoNames[tt.proto], info.notAfter, info.fingerprint)
+		}
+	}
+}
+
+func TestRecordTLS_WarningsAndRotation(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := &tlsInfo{version: tls.VersionTLS13, fingerprint: strings.Repeat("a", 64), notAfter: now.Add(90 * 24 * time.Hour)}
+	a2 := &tlsInfo{version: tls.VersionTLS13, fingerprint: a.fingerprint, notAfter: a.notAfter}
+	b := &tlsInfo{version: tls.VersionTLS13, fingerprint: strings.Repeat("b", 64), notAfter: now.Add(5 * 24 * time.Hour)}
+	expired := &tlsInfo{version: tls.VersionTLS13, fingerprint: b.fingerprint, notAfter: now.Add(-2 * time.Hour)}
+
+	s := &stats{certWarn: 14 * 24 * time.Hour}
+	tg := &target{s: s}
+	recordTLS(s, now, a)
+	recordTLS(s, now.Add(time.Second), a2)
+	if len(s.certChanges) != 0 || certWarnings(s, now) != "" || len(certAlerts(s, now)) != 0 {
+		t.Fatalf("same leaf: changes %v, warnings %q", s.certChanges, certWarnings(s, now))
+	}
+	if rotation(result{t: tg, measurement: measurement{tls: a2}}) != nil {
+		t.Error("rotation reported for an unchanged leaf")
+	}
+
+	at := time.Date(2026, 3, 1, 12, 34, 56, 0, time.UTC)
+	recordTLS(s, at, b)
+	if c := rotation(result{t: tg, measurement: measurement{tls: b}}); c == nil || c.from != a2 || c.to != b {
+		t.Fatalf("rotation = %+v; want a → b", c)
+	}
+	warn := certWarnings(s, now)
+	if !strings.Contains(warn, "[cert expires in 5d]") || !strings.Contains(warn, "[cert changed 12:34:56]") {
+		t.Errorf("warnings = %q", warn)
+	}
+	alerts := strings.Join(certAlerts(s, now), "\n")
+	for _, want := range []string{"certificate expires in 5d (2026-03-06), within --cert-warn 14d", "certificate changed at 12:34:56: aaaaaaaaaaaa → bbbbbbbbbbbb"} {
+		if !strings.Contains(alerts, want) {
+			t.Errorf("alerts missing %q:\n%s", want, alerts)
+		}
+	}
+
+	recordTLS(s, now, expired)
+	if warn := certWarnings(s, now); !strings.Contains(warn, "[cert expires in -2h]") {
+		t.Errorf("expired warnings = %q", warn)
+	}
+	s.certWarn = 0
+	if strings.Contains(certWarnings(s, now), "expires") {
+		t.Error("--cert-warn 0 still warns")
+	}
+}
+
+func TestRecorder_TLSOnlyWhenChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.hpz")
+	tg := &target{idx: 0, displayURL: "example.com", proto: protoHTTPS}
+	rec, err := newRecorder(path, []*target{tg}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Unix(1800000000, 0)
+	a := &tlsInfo{version: tls.VersionTLS13, cipher: tls.TLS_AES_128_GCM_SHA256, alpn: "h2", chain: []string{"example.com", "Root"}, notAfter: notAfter, fingerprint: "aa"}
+	b := &tlsInfo{version: tls.VersionTLS13, cipher: tls.TLS_AES_128_GCM_SHA256, alpn: "h2", notAfter: notAfter, fingerprint: "bb"}
+	for i, info := range []*tlsInfo{a, a, b} {
+		rec.write(result{t: tg, seq: i + 1, at: rec.start, proto: protoHTTPS, measurement: measurement{rtt: time.Millisecond, status: 200, tls: info}})
+	}
+	if err := rec.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := openRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := rc.targets(&options{})
+	results := make(chan result, 3)
+	if err := rc.replay(targets, results); err != nil {
+		t.Fatal(err)
+	}
+	close(results)
+	var got []*tlsInfo
+	for r := range results {
+		got = append(got, r.tls)
+	}
+	if len(got) != 3 || got[0] == nil || got[1] != nil || got[2] == nil {
+		t.Fatalf("replayed tls = %v; want it on the first and third entries only", got)
+	}
+	if !got[0].sameHeader(a) || !got[0].notAfter.Equal(notAfter) || strings.Join(got[0].chain, ",") != "example.com,Root" || got[2].fingerprint != "bb" {
+		t.Errorf("replayed tls = %+v, %+v", got[0], got[2])
+	}
+}
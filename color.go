@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+// colorOn reports whether ANSI colors are in use (see setColor).
+var colorOn = true
+
+// colorEnabled resolves --color against the environment. "auto" colors
+// only a terminal and honours NO_COLOR (https://no-color.org); "always"
+// and "never" override both.
+func colorEnabled(mode string, tty bool, noColor string) (bool, error) {
+	switch mode {
+	case "auto", "":
+		return tty && noColor == "", nil
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid --color %q (want auto, always or never)", mode)
+}
+
+// setColor switches the color and attribute sequences, and the values
+// built from them, on or off. Call it before anything is rendered.
+func setColor(on bool) {
+	colorOn = on
+	if on {
+		green, yellow, red, gray = "\033[32m", "\033[33m", "\033[31m", "\033[90m"
+		cyan, blue, magenta = "\033[36m", "\033[34m", "\033[35m"
+		bold, uline, dim, reset = "\033[1m", "\033[4m", "\033[2m", "\033[0m"
+	} else {
+		green, yellow, red, gray = "", "", "", ""
+		cyan, blue, magenta = "", "", ""
+		bold, uline, dim, reset = "", "", "", ""
+	}
+	invalidBlock = magenta + bold + "×" + reset
+	phaseColors = [4]string{cyan, blue, magenta, yellow}
+}
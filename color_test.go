@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: color selection
+// =============================================================================
+
+func TestColorEnabled_TableDriven(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		tty     bool
+		noColor string
+		want    bool
+		wantErr bool
+	}{
+		{"auto-tty", "auto", true, "", true, false},
+		{"auto-pipe", "auto", false, "", false, false},
+		{"auto-no-color", "auto", true, "1", false, false},
+		{"always-pipe", "always", false, "", true, false},
+		{"always-beats-no-color", "always", true, "1", true, false},
+		{"never-tty", "never", true, "", false, false},
+		{"invalid", "sometimes", true, "", false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := colorEnabled(tc.mode, tc.tty, tc.noColor)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v; wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("colorEnabled(%q, %v, %q) = %v; want %v", tc.mode, tc.tty, tc.noColor, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetColor_StripsEscapes(t *testing.T) {
+	setColor(false)
+	defer setColor(true)
+
+	for _, s := range []string{getBlock(50 * time.Millisecond), invalidBlock, legendText(false), phaseColors[0]} {
+		if strings.Contains(s, "\033") {
+			t.Errorf("%q contains an escape sequence with color off", s)
+		}
+	}
+	setColor(true)
+	if !strings.HasPrefix(getBlock(50*time.Millisecond), green) || green == "" {
+		t.Errorf("getBlock = %q; want green after setColor(true)", getBlock(50*time.Millisecond))
+	}
+}
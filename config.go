@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	flag "github.com/spf13/pflag"
+)
+
+// Config keys that are not flags. Every other key must be a long flag name.
+const (
+	cfgTargets  = "targets"
+	cfgProtocol = "protocol"
+	cfgProfiles = "profiles"
+)
+
+// Flags that make no sense in a config file
+var cfgForbidden = map[string]bool{"help": true, "version": true, "config": true, "profile": true}
+
+// Values accepted by the "protocol" key, mapped to the flag they enable
+// ("" means the default HTTPS auto-negotiation).
+var cfgProtocols = map[string]string{
+	"http1": "http", "http": "http",
+	"https": "",
+	"http2": "http2",
+	"http3": "http3",
+}
+
+// configPath returns the config file location: $XDG_CONFIG_HOME/hp/hp.toml,
+// falling back to ~/.config/hp/hp.toml.
+func configPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "hp", "hp.toml")
+}
+
+// loadConfig reads the config file at path and returns its top-level
+// settings overlaid with those of the named profile. A missing file is
+// not an error unless a profile was requested or required is set.
+func loadConfig(path, profile string, required bool) (map[string]any, error) {
+	var raw map[string]any
+	if _, err := toml.DecodeFile(path, &raw); err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !required && profile == "" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	cfg := map[string]any{}
+	for k, v := range raw {
+		if k != cfgProfiles {
+			cfg[k] = v
+		}
+	}
+	if profile == "" {
+		return cfg, nil
+	}
+
+	profiles, _ := raw[cfgProfiles].(map[string]any)
+	p, ok := profiles[profile].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("config %s: profile %q not found", path, profile)
+	}
+	for k, v := range p {
+		cfg[k] = v
+	}
+	return cfg, nil
+}
+
+// applyConfig seeds every flag not given on the command line with its
+// value from cfg, so precedence stays flags > config. Threshold env vars
+// are resolved afterwards (see threshold). Returns the configured target
+// list, if any.
+func applyConfig(fset *flag.FlagSet, cfg map[string]any) ([]string, error) {
+	var targets []string
+
+	// Sorted for deterministic error reporting
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := cfg[k]
+		switch k {
+		case cfgTargets:
+			list, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("config: %s must be a list of hosts", k)
+			}
+			for _, item := range list {
+				targets = append(targets, fmt.Sprint(item))
+			}
+			continue
+		case cfgProtocol:
+			name, ok := cfgProtocols[fmt.Sprint(v)]
+			if !ok {
+				return nil, fmt.Errorf("config: unknown protocol %q (want http1, https, http2 or http3)", v)
+			}
+			if fset.Changed("http") || fset.Changed("http2") || fset.Changed("http3") || name == "" {
+				continue
+			}
+			k, v = name, true
+		}
+
+		f := fset.Lookup(k)
+		if f == nil || cfgForbidden[k] {
+			return nil, fmt.Errorf("config: unknown setting %q", k)
+		}
+		if fset.Changed(k) {
+			continue
+		}
+		values, ok := v.([]any)
+		if !ok {
+			values = []any{v}
+		}
+		for _, item := range values {
+			// Value.Set does not mark the flag as Changed, so later
+			// checks can still tell config values from command-line ones.
+			if err := f.Value.Set(fmt.Sprint(item)); err != nil {
+				return nil, fmt.Errorf("config: %s: %v", k, err)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// threshold resolves a latency threshold with precedence
+// flag > env > config > default. val is the flag's current value, which
+// holds the config value unless the flag was given explicitly; 0 means unset.
+func threshold(fset *flag.FlagSet, name, env string, val, def int64) int64 {
+	if fset.Changed(name) && val > 0 {
+		return val
+	}
+	if val > 0 {
+		def = val
+	}
+	return getEnvInt(env, def)
+}
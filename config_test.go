@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// =============================================================================
+// Test: config file and profile handling
+// =============================================================================
+
+const testConfig = `
+interval = "2s"
+green = 100
+
+[profiles.vpn]
+targets = ["10.0.0.1", "intranet.corp"]
+interval = "500ms"
+yellow = 250
+protocol = "http3"
+insecure = true
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hp.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestFlagSet mirrors the subset of main's flags the config tests touch.
+func newTestFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("hp", flag.ContinueOnError)
+	fs.DurationP("interval", "i", time.Second, "")
+	fs.Int64P("green", "g", 0, "")
+	fs.Int64P("yellow", "y", 0, "")
+	fs.BoolP("insecure", "k", false, "")
+	fs.BoolP("http", "1", false, "")
+	fs.BoolP("http2", "2", false, "")
+	fs.BoolP("http3", "3", false, "")
+	fs.BoolP("version", "v", false, "")
+	return fs
+}
+
+func TestConfigPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/xdg")
+	if got := configPath(); got != filepath.Join("/tmp/xdg", "hp", "hp.toml") {
+		t.Errorf("configPath() = %q; want /tmp/xdg/hp/hp.toml", got)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/someone")
+	if got := configPath(); got != filepath.Join("/home/someone", ".config", "hp", "hp.toml") {
+		t.Errorf("configPath() = %q; want ~/.config/hp/hp.toml", got)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, testConfig)
+
+	t.Run("defaults-only", func(t *testing.T) {
+		cfg, err := loadConfig(path, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg["interval"] != "2s" || cfg["green"] != int64(100) {
+			t.Errorf("cfg = %v; want interval 2s, green 100", cfg)
+		}
+		if _, ok := cfg["profiles"]; ok {
+			t.Error("profiles table should not leak into settings")
+		}
+	})
+
+	t.Run("profile-overlays-defaults", func(t *testing.T) {
+		cfg, err := loadConfig(path, "vpn", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg["interval"] != "500ms" || cfg["green"] != int64(100) || cfg["yellow"] != int64(250) {
+			t.Errorf("cfg = %v; want profile interval with top-level green", cfg)
+		}
+	})
+
+	t.Run("unknown-profile", func(t *testing.T) {
+		if _, err := loadConfig(path, "nope", false); err == nil {
+			t.Error("expected error for unknown profile")
+		}
+	})
+
+	t.Run("missing-file", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "none.toml")
+		if cfg, err := loadConfig(missing, "", false); err != nil || cfg != nil {
+			t.Errorf("loadConfig(missing) = %v, %v; want nil, nil", cfg, err)
+		}
+		if _, err := loadConfig(missing, "vpn", false); err == nil {
+			t.Error("expected error when a profile is requested without a config file")
+		}
+		if _, err := loadConfig(missing, "", true); err == nil {
+			t.Error("expected error for an explicit --config that does not exist")
+		}
+	})
+}
+
+func TestApplyConfig(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, testConfig), "vpn", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := newTestFlagSet()
+	if err := fs.Parse([]string{"-i", "3s"}); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := applyConfig(fs, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(targets) != 2 || targets[1] != "intranet.corp" {
+		t.Errorf("targets = %v; want [10.0.0.1 intranet.corp]", targets)
+	}
+	if got, _ := fs.GetDuration("interval"); got != 3*time.Second {
+		t.Errorf("interval = %v; want 3s (command line wins)", got)
+	}
+	if got, _ := fs.GetInt64("yellow"); got != 250 {
+		t.Errorf("yellow = %d; want 250 from profile", got)
+	}
+	if got, _ := fs.GetBool("http3"); !got {
+		t.Error("protocol = http3 should enable --http3")
+	}
+	if got, _ := fs.GetBool("insecure"); !got {
+		t.Error("insecure should be set from profile")
+	}
+	if fs.Changed("yellow") {
+		t.Error("config values must not mark flags as changed")
+	}
+}
+
+func TestApplyConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  map[string]any
+	}{
+		{"unknown-key", map[string]any{"colour": "red"}},
+		{"forbidden-key", map[string]any{"version": true}},
+		{"bad-protocol", map[string]any{"protocol": "gopher"}},
+		{"bad-value", map[string]any{"interval": "soon"}},
+		{"targets-not-list", map[string]any{"targets": "example.com"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := applyConfig(newTestFlagSet(), tc.cfg); err == nil {
+				t.Errorf("applyConfig(%v) = nil error; want error", tc.cfg)
+			}
+		})
+	}
+}
+
+func TestThreshold_Precedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		env    string
+		cfgVal int64 // value seeded from config when the flag is unset
+		want   int64
+	}{
+		{"default", nil, "", 0, 150},
+		{"config", nil, "", 100, 100},
+		{"env-beats-config", nil, "90", 100, 90},
+		{"flag-beats-env", []string{"-g", "70"}, "90", 0, 70},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := newTestFlagSet()
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			val, _ := fs.GetInt64("green")
+			if !fs.Changed("green") {
+				val = tc.cfgVal
+			}
+			t.Setenv("TEST_HP_GREEN", tc.env)
+			if got := threshold(fs, "green", "TEST_HP_GREEN", val, 150); got != tc.want {
+				t.Errorf("threshold() = %d; want %d", got, tc.want)
+			}
+		})
+	}
+}
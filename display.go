@@ -0,0 +1,491 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// view renders probe results to the terminal. All methods are called with
+// displayMu held.
+type view interface {
+	start()          // print header/legend and reserve screen space
+	update(r result) // render a result after it has been recorded
+	redraw()         // repaint after resuming from suspend
+	refresh()        // repaint in place after a keyboard change
+	resize()         // repaint for a new terminal width
+	final()          // print the end-of-run summary
+}
+
+// headlessView prints nothing; used with --headless when only the
+// metrics endpoint is wanted.
+type headlessView struct{}
+
+func (headlessView) start()        {}
+func (headlessView) update(result) {}
+func (headlessView) redraw()       {}
+func (headlessView) refresh()      {}
+func (headlessView) resize()       {}
+func (headlessView) final()        {}
+
+// legendText returns the legend line for block or braille mode.
+func legendText(braille bool) string {
+	if braille {
+		return fmt.Sprintf("%sLegend: %s⡀⡄%s<%dms %s⡆%s<%dms %s⡇%s>=%dms %s%s!%sfail %s(2x density)%s",
+			gray, green, reset, greenThreshold, yellow, reset, yellowThreshold, red, reset, yellowThreshold, red, bold, reset, gray, reset)
+	}
+	return fmt.Sprintf("%sLegend: %s▁▂▃%s<%dms %s▄▅%s<%dms %s▆▇█%s>=%dms %s%s!%sfail%s",
+		gray, green, reset, greenThreshold, yellow, reset, yellowThreshold, red, reset, yellowThreshold, red, bold, reset, reset)
+}
+
+// singleView is the classic one-target display: a wrapping bar with a
+// stats line below it.
+type singleView struct {
+	t           *target
+	o           *options
+	shown       *tlsInfo // TLS state in the header (nil = none yet)
+	headerGap   int      // lines from the header down to the bar while the bar is empty (0 = not adjacent)
+	legendAbove bool     // the start-up legend sits between header and bar
+}
+
+// printHeader prints the target line and, once a handshake has been seen,
+// a TLS line below it. It returns the number of lines printed.
+func (v *singleView) printHeader() int {
+	t := v.t
+	// Move to beginning of line and clear
+	fmt.Print(col0 + clearLn)
+	h3 := ""
+	if t.h3 != nil {
+		h3 = " " + cyan + t.h3.String() + gray
+	}
+	if t.resolvedIP != "" {
+		fmt.Printf("%sHittyPing (v%s) %s%s%s [%s%s%s] (%s)%s%s\n", gray, version, reset+bold, t.displayURL, reset+gray, reset, addrText(t), gray, protoNames[t.proto], h3, reset)
+	} else {
+		fmt.Printf("%sHittyPing (v%s) %s%s %s(%s)%s%s\n", gray, version, reset+bold, t.displayURL, reset+gray, protoNames[t.proto], h3, reset)
+	}
+	if v.shown == nil {
+		return 1
+	}
+	color := gray
+	if certExpiring(t.s, clock()) {
+		color = yellow
+	}
+	fmt.Println(col0 + clearLn + truncateToWidth(color+"  "+v.shown.describe(clock())+reset, getTermWidth()))
+	return 2
+}
+
+// notice prints msg on its own line and repeats the header below it; the
+// bar continues on a fresh line.
+func (v *singleView) notice(msg string) {
+	fmt.Printf("\n%s%s\n", clearLn, msg)
+	v.headerGap = v.printHeader()
+	v.legendAbove = false
+	fmt.Println() // Reserve stats line
+	fmt.Print(up) // Move back to bar line
+	v.t.s.lineStart = v.t.s.lastPrinted
+	v.t.s.col = 0
+}
+
+func (v *singleView) start() {
+	if v.o.header {
+		v.headerGap = v.printHeader()
+	}
+	if v.o.legend {
+		fmt.Println(legendText(v.o.braille))
+		v.legendAbove = true
+		v.headerGap++
+	}
+	fmt.Println() // Reserve stats line
+	fmt.Print(up) // Move back to bar line
+}
+
+func (v *singleView) update(r result) {
+	if !r.switched {
+		if v.o.header {
+			v.updateHeader(r)
+		}
+		printDisplay(v.t.s)
+		v.headerGap = 0
+		return
+	}
+	// Print switch message and update header
+	if v.o.header {
+		switch {
+		case r.advertised:
+			v.notice(fmt.Sprintf("%s↑ Upgrading to %s (advertised via Alt-Svc)%s", green, protoNames[r.proto], reset))
+		case r.upgraded():
+			v.notice(fmt.Sprintf("%s↑ Upgrading back to %s (recovered)%s", green, protoNames[r.proto], reset))
+		default:
+			v.notice(fmt.Sprintf("%s↓ Downgrading to %s (%d consecutive failures)%s", yellow, protoNames[r.proto], v.o.downAfter, reset))
+		}
+	}
+}
+
+// updateHeader brings the header up to date when the Alt-Svc
+// advertisement or the TLS state changed. While the header is still right
+// above an empty bar it is rewritten in place; otherwise, and always for a
+// certificate rotation, a notice line is printed with a new header.
+func (v *singleView) updateHeader(r result) {
+	rotated := r.tls != nil && v.shown != nil && r.tls.fingerprint != v.shown.fingerprint
+	var msg string
+	switch altChanged, dialChanged := v.t.noteAltSvc(r.altSvc), v.t.noteDialed(r.remote); {
+	case rotated:
+		msg = fmt.Sprintf("%s⚠ Certificate changed: %s → %s (expires %s)%s",
+			yellow, v.shown.short(), r.tls.short(), r.tls.notAfter.Format(time.DateOnly), reset)
+	case altChanged && v.t.h3 != nil:
+		msg = cyan + altSvcText(v.t) + reset
+	case altChanged:
+		msg = gray + altSvcText(v.t) + reset
+	case r.tls != nil && !r.tls.sameHeader(v.shown):
+		msg = gray + "TLS: " + r.tls.describe(clock()) + reset
+	case dialChanged:
+		msg = gray + "Connected to " + addrText(v.t) + reset
+	default:
+		return
+	}
+	if r.tls != nil {
+		v.shown = r.tls
+	}
+	if v.headerGap == 0 || rotated {
+		v.notice(msg)
+		return
+	}
+	fmt.Printf("\033[%dA%s%s", v.headerGap, col0, clearDn)
+	v.headerGap = v.printHeader()
+	if v.legendAbove {
+		fmt.Println(legendText(v.o.braille))
+		v.headerGap++
+	}
+	fmt.Println() // Reserve stats line
+	fmt.Print(up) // Move back to bar line
+}
+
+func (v *singleView) redraw() {
+	v.headerGap = 0
+	fmt.Println() // reserve stats line
+	fmt.Print(up) // move back to bar line
+	redrawDisplay(v.t.s)
+}
+
+func (v *singleView) refresh() {
+	s := v.t.s
+	// Reprint the current bar line, then any blocks added since
+	fmt.Print(col0 + clearLn)
+	redrawDisplay(s)
+}
+
+func (v *singleView) resize() {
+	v.headerGap = 0
+	reflowDisplay(v.t.s)
+}
+
+func (v *singleView) final() {
+	if v.t.s.legendShown {
+		fmt.Println() // step over the legend line below the stats
+	}
+	printFinal(v.t.displayURL, v.t.s, v.o.slo)
+}
+
+// multiView stacks one block per target (blank line, label, bar) and
+// updates each block in place using relative cursor movement. The cursor
+// rests on the line below the last bar. When the terminal is too short to
+// hold every block it scrolls instead, one line per probe as in lineView.
+type multiView struct {
+	targets []*target
+	o       *options
+	title   string    // rows are one target seen several ways, e.g. "dual-stack"
+	scroll  *lineView // non-nil while the terminal is too short
+}
+
+// height returns the number of rows the in-place display needs.
+func (v *multiView) height() int {
+	n := 3*len(v.targets) + 1 // blocks plus the cursor line
+	if v.o.header {
+		n++
+	}
+	if v.o.legend {
+		n++
+	}
+	return n
+}
+
+// fits reports whether the in-place display fits in rows (0 = unknown).
+// Relative cursor movement clamps at the top row, so a display taller
+// than the screen would be overwritten from the wrong line.
+func (v *multiView) fits(rows int) bool {
+	return rows == 0 || v.height() <= rows
+}
+
+func (v *multiView) start() {
+	if !v.fits(getTermHeight()) {
+		v.scroll = &lineView{targets: v.targets, o: v.o, w: os.Stdout}
+		v.scroll.start()
+		return
+	}
+	v.scroll = nil
+	if v.o.header && v.title != "" {
+		fmt.Printf("%sHittyPing (v%s) %s%s %s(%s)%s\n", gray, version, reset+bold, v.targets[0].displayURL, reset+gray, v.title, reset)
+	} else if v.o.header {
+		fmt.Printf("%sHittyPing (v%s) %smulti-target (%d hosts)%s\n", gray, version, reset+bold, len(v.targets), reset)
+	}
+	if v.o.legend {
+		fmt.Println(legendText(v.o.braille))
+	}
+	v.redraw()
+}
+
+func (v *multiView) update(r result) {
+	if v.scroll != nil {
+		v.scroll.update(r)
+		return
+	}
+	width := getTermWidth()
+	t := r.t
+	if !r.switched {
+		// Both are shown in the label
+		t.noteAltSvc(r.altSvc)
+		t.noteDialed(r.remote)
+	}
+	// Lines between the cursor and this target's label line
+	n := 3*(len(v.targets)-t.idx) - 1
+	fmt.Printf("\033[%dA%s%s%s\n%s%s%s\033[%dB%s", n,
+		col0, clearLn, truncateToWidth(targetLabel(t), width),
+		col0, clearLn, barTail(t.s.blocks, width),
+		n-1, col0)
+}
+
+func (v *multiView) redraw() {
+	if v.scroll != nil {
+		return
+	}
+	width := getTermWidth()
+	for _, t := range v.targets {
+		fmt.Printf("\n%s\n%s\n", truncateToWidth(targetLabel(t), width), barTail(t.s.blocks, width))
+	}
+	v.printLegend(width)
+}
+
+func (v *multiView) refresh() {
+	if v.scroll != nil {
+		return
+	}
+	for _, t := range v.targets {
+		v.update(result{t: t})
+	}
+	v.printLegend(getTermWidth())
+}
+
+// resize repaints everything from the top of the screen: rows above the
+// cursor may have been re-wrapped by the terminal, so relative movement
+// can no longer find each target's lines. A scrolling display keeps
+// scrolling until the terminal is tall enough again.
+func (v *multiView) resize() {
+	if v.scroll != nil && !v.fits(getTermHeight()) {
+		return
+	}
+	fmt.Print("\033[H\033[2J")
+	v.start()
+}
+
+// printLegend shows (or clears) the toggleable legend on the cursor line
+// below the last bar.
+func (v *multiView) printLegend(width int) {
+	fmt.Print(col0 + clearLn)
+	if v.targets[0].s.legend {
+		fmt.Print(truncateToWidth(legendText(v.targets[0].s.braille), width) + col0)
+	}
+}
+
+func (v *multiView) final() {
+	fmt.Println()
+	printSummaryTable(v.targets, v.o.slo)
+}
+
+// printSummaryTable prints the multi-target summary table followed by any
+// per-target SLO breaches.
+func printSummaryTable(targets []*target, lim slo) {
+	for _, line := range summaryTable(targets) {
+		fmt.Println(line)
+	}
+	for _, t := range targets {
+		if _, reasons := lim.check(t.s); len(reasons) > 0 {
+			fmt.Printf("%s: %s\n", t.name(), sloLine(reasons))
+		}
+		for _, line := range certAlerts(t.s, clock()) {
+			fmt.Printf("%s: %s\n", t.name(), line)
+		}
+	}
+}
+
+// lineView is used when stdout is not a terminal (a pipe, file or cron
+// mail): one timestamped line per probe, no cursor movement, and the
+// usual summary at the end.
+type lineView struct {
+	targets []*target
+	o       *options
+	w       io.Writer
+	shown   map[*target]*tlsInfo // TLS state last printed per target
+}
+
+func (v *lineView) start() {
+	if !v.o.header {
+		return
+	}
+	for _, t := range v.targets {
+		ip := ""
+		if t.resolvedIP != "" {
+			ip = " [" + addrText(t) + "]"
+		}
+		fmt.Fprintf(v.w, "HittyPing (v%s) %s%s (%s)\n", version, t.displayURL, ip, protoNames[t.proto])
+	}
+}
+
+func (v *lineView) update(r result) {
+	fmt.Fprintf(v.w, "%s\n", probeLine(r, v.o.phaseBar))
+	if !r.switched && r.t.noteAltSvc(r.altSvc) {
+		fmt.Fprintf(v.w, "%s %s %s\n", r.at.Format(time.DateTime), r.t.displayURL, altSvcText(r.t))
+	}
+	if c := rotation(r); c != nil {
+		fmt.Fprintf(v.w, "%s %s certificate changed %s → %s (expires %s)\n",
+			r.at.Format(time.DateTime), r.t.displayURL, c.from.short(), c.to.short(), c.to.notAfter.Format(time.DateOnly))
+	}
+	if r.tls != nil && !r.tls.sameHeader(v.shown[r.t]) {
+		if v.shown == nil {
+			v.shown = map[*target]*tlsInfo{}
+		}
+		v.shown[r.t] = r.tls
+		fmt.Fprintf(v.w, "%s %s TLS: %s\n", r.at.Format(time.DateTime), r.t.displayURL, r.tls.describe(r.at))
+	}
+}
+
+func (v *lineView) redraw()  {}
+func (v *lineView) refresh() {}
+func (v *lineView) resize()  {}
+
+func (v *lineView) final() {
+	if len(v.targets) == 1 {
+		t := v.targets[0]
+		printFinal(t.displayURL, t.s, v.o.slo)
+		return
+	}
+	fmt.Println()
+	printSummaryTable(v.targets, v.o.slo)
+}
+
+// addrText is the bracketed address in headers and labels: the IP that
+// carried the last probe (the resolved one until then), followed by its
+// family unless the label already names it. A --resolve/--connect-to
+// address keeps its port.
+func addrText(t *target) string {
+	addr := t.resolvedIP
+	if t.dialed != "" {
+		if host, _, err := net.SplitHostPort(addr); err != nil || host != t.dialed {
+			addr = t.dialed
+		}
+	}
+	family := t.addrFamily()
+	if family == 0 || strings.HasSuffix(t.label, familyName(family)) {
+		return addr
+	}
+	return addr + " " + familyName(family)
+}
+
+// probeLine formats a result for lineView:
+//
+//	2026-05-17 14:03:21 example.com seq=3 HTTPS status=200 time=23ms ▂
+//
+// Failures end in "error: ..."; assertion failures keep their timing.
+func probeLine(r result, withPhases bool) string {
+	prefix := fmt.Sprintf("%s %s", r.at.Format(time.DateTime), r.t.displayURL)
+	if r.switched {
+		return fmt.Sprintf("%s %s to %s", prefix, switchName(r), protoNames[r.proto])
+	}
+	line := fmt.Sprintf("%s seq=%d %s", prefix, r.seq, protoNames[r.proto])
+	if f := probeFamily(r); f != 0 {
+		line += " " + familyName(f)
+	}
+	if r.warmup {
+		line += " warmup"
+	}
+	switch {
+	case isAssertError(r.err):
+		return fmt.Sprintf("%s status=%d time=%sms %s invalid: %v", line, r.status, fmtMs(r.rtt), invalidBlock, r.err)
+	case r.err != nil:
+		return fmt.Sprintf("%s %s%s!%s error: %v", line, red, bold, reset, r.err)
+	}
+	block := getBlock(r.rtt)
+	if r.warmup {
+		block = warmupBlock(r.rtt)
+	}
+	line = fmt.Sprintf("%s status=%d time=%sms %s", line, r.status, fmtMs(r.rtt), block)
+	if r.t.s.reuse {
+		if r.ph.reused {
+			line += " reused"
+		} else {
+			line += " new"
+		}
+	}
+	if withPhases {
+		line += " " + formatPhases(r.ph)
+	}
+	return line
+}
+
+// targetLabel returns the hostname line shown above a target's bar in
+// multi-target mode: host, resolved IP, protocol, Alt-Svc, TLS parameters
+// and live stats.
+func targetLabel(t *target) string {
+	ip := ""
+	if t.resolvedIP != "" {
+		ip = fmt.Sprintf(" %s[%s%s%s]", gray, reset, addrText(t), gray)
+	}
+	extra := ""
+	if t.h3 != nil {
+		extra = " " + cyan + t.h3.String() + reset
+	}
+	if t.s.tls != nil {
+		extra += " " + gray + t.s.tls.params() + reset
+	}
+	if t.label != "" {
+		// The label already names the protocol
+		return fmt.Sprintf("%s%s%s%s%s  %s", bold, t.label, reset, ip, extra, formatStats(t.s))
+	}
+	return fmt.Sprintf("%s%s%s%s %s(%s)%s%s  %s", bold, t.displayURL, reset, ip, gray, protoNames[t.proto], reset, extra, formatStats(t.s))
+}
+
+// barTail joins the most recent blocks that fit on one line of the given
+// width, so multi-target bars scroll horizontally instead of wrapping.
+func barTail(blocks []string, width int) string {
+	n := max(width-1, 0)
+	start := max(len(blocks)-n, 0)
+	return strings.Join(blocks[start:], "")
+}
+
+// summaryTable returns the final min/avg/max/p95/loss table for multiple
+// targets, followed by the average phase breakdown.
+func summaryTable(targets []*target) []string {
+	nameWidth := 0
+	for _, t := range targets {
+		if len(t.name()) > nameWidth {
+			nameWidth = len(t.name())
+		}
+	}
+	lines := []string{
+		fmt.Sprintf("%sSummary:%s", gray, reset),
+		fmt.Sprintf("%-*s  %6s %6s %6s %6s %5s  %6s %6s %6s %6s", nameWidth, "", "min", "avg", "max", "p95", "loss", "dns", "tcp", "tls", "ttfb"),
+	}
+	for _, t := range targets {
+		lossPct, minMs, avgMs, maxMs := summarize(t.s)
+		if t.s.count == 0 {
+			lines = append(lines, fmt.Sprintf("%-*s  %6s %6s %6s %6s %4d%%  %6s %6s %6s %6s", nameWidth, t.name(), "-", "-", "-", "-", lossPct, "-", "-", "-", "-"))
+			continue
+		}
+		ph := t.s.phaseTotal.div(t.s.count)
+		lines = append(lines, fmt.Sprintf("%-*s  %4dms %4dms %4dms %4dms %4d%%  %4dms %4dms %4dms %4dms", nameWidth, t.name(), minMs, avgMs, maxMs, percentile(t.s, 0.95).Milliseconds(), lossPct,
+			ph.dns.Milliseconds(), ph.connect.Milliseconds(), ph.tls.Milliseconds(), ph.ttfb.Milliseconds()))
+	}
+	return lines
+}
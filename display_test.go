@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: multi-target display helpers
+// =============================================================================
+
+func TestBarTail(t *testing.T) {
+	blocks := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		name  string
+		width int
+		want  string
+	}{
+		{"fits", 10, "abcde"},
+		{"exact", 6, "abcde"},
+		{"scrolls", 4, "cde"},
+		{"width-one", 1, ""},
+		{"width-zero", 0, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := barTail(blocks, tc.width); got != tc.want {
+				t.Errorf("barTail(width=%d) = %q; want %q", tc.width, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSummaryTable(t *testing.T) {
+	targets := []*target{
+		{displayURL: "google.com", s: &stats{count: 2, failures: 0, total: 100 * time.Millisecond, min: 45 * time.Millisecond, max: 55 * time.Millisecond}},
+		{displayURL: "1.1.1.1", s: &stats{failures: 3, min: time.Hour}},
+	}
+	lines := summaryTable(targets)
+	if len(lines) != 4 {
+		t.Fatalf("lines = %d; want 4", len(lines))
+	}
+	if !strings.HasPrefix(lines[2], "google.com  ") || !strings.Contains(lines[2], "45ms") || !strings.Contains(lines[2], "50ms") || !strings.Contains(lines[2], " 0%") {
+		t.Errorf("row = %q; want google.com with 45/50/55ms and 0%% loss", lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "1.1.1.1     ") || !strings.Contains(lines[3], "100%") {
+		t.Errorf("row = %q; want padded 1.1.1.1 with 100%% loss", lines[3])
+	}
+	// Columns line up: every row has the same visible width
+	if len(lines[1]) != len(lines[2]) || len(lines[2]) != len(lines[3]) {
+		t.Errorf("row widths differ: %d/%d/%d", len(lines[1]), len(lines[2]), len(lines[3]))
+	}
+}
+
+func TestSummaryTable_UsesLabel(t *testing.T) {
+	targets := []*target{
+		{displayURL: "example.com", label: "example.com HTTP/1.1", proto: protoHTTP1, s: &stats{min: time.Hour}},
+		{displayURL: "example.com", label: "example.com HTTP/3", proto: protoHTTP3, s: &stats{min: time.Hour}},
+	}
+	lines := summaryTable(targets)
+	if !strings.HasPrefix(lines[2], "example.com HTTP/1.1  ") || !strings.HasPrefix(lines[3], "example.com HTTP/3    ") {
+		t.Errorf("rows = %q, %q; want padded protocol labels", lines[2], lines[3])
+	}
+	if label := targetLabel(targets[1]); strings.Contains(label, "(HTTP/3)") {
+		t.Errorf("targetLabel = %q; label already names the protocol", label)
+	}
+}
+
+// =============================================================================
+// Test: line-oriented output for non-terminal stdout
+// =============================================================================
+
+func TestProbeLine(t *testing.T) {
+	setColor(false)
+	defer setColor(true)
+
+	at := time.Date(2026, 5, 17, 14, 3, 21, 0, time.UTC)
+	tg := &target{displayURL: "example.com", s: &stats{}}
+	tests := []struct {
+		name   string
+		r      result
+		phases bool
+		want   string
+	}{
+		{"ok", result{t: tg, seq: 3, at: at, proto: protoHTTPS, measurement: measurement{rtt: 23 * time.Millisecond, status: 200}},
+			false, "2026-05-17 14:03:21 example.com seq=3 HTTPS status=200 time=23ms ▁"},
+		{"phases", result{t: tg, seq: 1, at: at, proto: protoHTTPS, measurement: measurement{rtt: 30 * time.Millisecond, status: 200, ph: phases{dns: 2 * time.Millisecond, ttfb: 20 * time.Millisecond}}},
+			true, "2026-05-17 14:03:21 example.com seq=1 HTTPS status=200 time=30ms ▁ dns 2 ttfb 20ms"},
+		{"failure", result{t: tg, seq: 4, at: at, proto: protoHTTP2, err: errors.New("timeout")},
+			false, "2026-05-17 14:03:21 example.com seq=4 HTTP/2 ! error: timeout"},
+		{"invalid", result{t: tg, seq: 5, at: at, proto: protoHTTPS, measurement: measurement{rtt: 5 * time.Millisecond, status: 503}, err: &assertError{"unexpected status 503"}},
+			false, "2026-05-17 14:03:21 example.com seq=5 HTTPS status=503 time=5.0ms × invalid: unexpected status 503"},
+		{"downgrade", result{t: tg, at: at, proto: protoHTTP2, switched: true, from: protoHTTP3},
+			false, "2026-05-17 14:03:21 example.com downgrade to HTTP/2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := probeLine(tc.r, tc.phases); got != tc.want {
+				t.Errorf("probeLine = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLineView_NoEscapes(t *testing.T) {
+	setColor(false)
+	defer setColor(true)
+
+	var buf bytes.Buffer
+	tg := &target{displayURL: "example.com", resolvedIP: "192.0.2.1", proto: protoHTTPS, s: &stats{min: time.Hour}}
+	v := &lineView{targets: []*target{tg}, o: &options{header: true}, w: &buf}
+	v.start()
+	recordResult(tg.s, 40*time.Millisecond, phases{}, nil)
+	v.update(result{t: tg, seq: 1, at: time.Now(), proto: protoHTTPS, measurement: measurement{rtt: 40 * time.Millisecond, status: 200}})
+
+	out := buf.String()
+	if strings.Contains(out, "\033") {
+		t.Errorf("output contains escape sequences: %q", out)
+	}
+	if !strings.HasPrefix(out, "HittyPing (v"+version+") example.com [192.0.2.1] (HTTPS)\n") || strings.Count(out, "\n") != 2 {
+		t.Errorf("output = %q; want header plus one probe line", out)
+	}
+}
+
+func TestMultiView_Fits(t *testing.T) {
+	targets := make([]*target, 4)
+	v := &multiView{targets: targets, o: &options{header: true, legend: true}}
+	// 4 blocks of 3 lines, header, legend and the cursor line
+	if got := v.height(); got != 15 {
+		t.Errorf("height = %d; want 15", got)
+	}
+	for _, tc := range []struct {
+		rows int
+		want bool
+	}{{0, true}, {14, false}, {15, true}, {50, true}} {
+		if got := v.fits(tc.rows); got != tc.want {
+			t.Errorf("fits(%d) = %v; want %v", tc.rows, got, tc.want)
+		}
+	}
+}
+
+// =============================================================================
+// Test: Alt-Svc advertisements and protocol switches in every view
+// =============================================================================
+
+func TestAltSvc_ShownInEveryView(t *testing.T) {
+	setColor(false)
+	defer setColor(true)
+
+	newTg := func() *target {
+		return &target{displayURL: "example.com", host: "example.com", proto: protoHTTPS, s: &stats{min: time.Hour}}
+	}
+	probes := func(tg *target) []result {
+		var rs []result
+		for i, v := range []string{`h3=":443"; ma=60`, `h3=":443"; ma=60`, "", "clear"} {
+			rs = append(rs, result{t: tg, seq: i + 1, at: time.Now(), proto: protoHTTPS, measurement: measurement{rtt: time.Millisecond, status: 200, altSvc: v}})
+		}
+		return rs
+	}
+
+	// Piped output: one notice per change
+	var buf bytes.Buffer
+	tg := newTg()
+	lv := &lineView{targets: []*target{tg}, o: &options{}, w: &buf}
+	for _, r := range probes(tg) {
+		lv.update(r)
+	}
+	if out := buf.String(); strings.Count(out, "Alt-Svc: h3 on :443, max-age 1m00s") != 1 || strings.Count(out, "Alt-Svc: h3 no longer advertised") != 1 {
+		t.Errorf("line output = %q; want one notice for the advertisement and one for its withdrawal", out)
+	}
+
+	// JSON: one alt_svc event per change
+	buf.Reset()
+	tg = newTg()
+	jv := newJSONView([]*target{tg}, slo{}, &buf)
+	for _, r := range probes(tg) {
+		jv.update(r)
+	}
+	out := buf.String()
+	if strings.Count(out, `"type":"alt_svc"`) != 2 || !strings.Contains(out, `"h3":"example.com:443","max_age_s":60`) {
+		t.Errorf("json output = %s; want an alt_svc event with the address, then one without", out)
+	}
+
+	// Multi-target label
+	tg = newTg()
+	tg.noteAltSvc(`h3=":8443"`)
+	if label := targetLabel(tg); !strings.Contains(label, "(HTTPS) h3 on :8443") {
+		t.Errorf("targetLabel = %q; want the advertisement after the protocol", label)
+	}
+}
+
+func TestTLS_ShownInEveryView(t *testing.T) {
+	setColor(false)
+	defer setColor(true)
+
+	info := &tlsInfo{version: tls.VersionTLS13, cipher: tls.TLS_AES_128_GCM_SHA256, alpn: "h2", fingerprint: "aa"}
+	tg := &target{displayURL: "example.com", host: "example.com", proto: protoHTTP2, s: &stats{min: time.Hour}}
+
+	// Piped output: one line per TLS state, not per probe
+	var buf bytes.Buffer
+	lv := &lineView{targets: []*target{tg}, o: &options{}, w: &buf}
+	for i := range 3 {
+		r := result{t: tg, seq: i + 1, at: time.Now(), proto: protoHTTP2, measurement: measurement{rtt: time.Millisecond, status: 200, tls: info}}
+		recordTLS(tg.s, r.at, info)
+		lv.update(r)
+	}
+	if out := buf.String(); strings.Count(out, "TLS: TLS 1.3 TLS_AES_128_GCM_SHA256 h2") != 1 {
+		t.Errorf("line output = %q; want the TLS parameters once", out)
+	}
+
+	// Multi-target label
+	if label := targetLabel(tg); !strings.Contains(label, "(HTTP/2) TLS 1.3 TLS_AES_128_GCM_SHA256 h2") {
+		t.Errorf("targetLabel = %q; want the TLS parameters after the protocol", label)
+	}
+}
+
+func TestPrintFinal_TimelineShowsSwitchesWithoutFailures(t *testing.T) {
+	setColor(false)
+	defer setColor(true)
+
+	s := &stats{min: time.Hour}
+	recordResult(s, 10*time.Millisecond, phases{}, nil)
+	recordSwitch(s, time.Now(), protoHTTPS, protoHTTP3)
+	recordResult(s, 10*time.Millisecond, phases{}, nil)
+	closePeriods(s)
+
+	out := captureStdout(t, func() { printFinal("example.com", s, slo{}) })
+	if !strings.Contains(out, "timeline:") || !strings.Contains(out, "↑ HTTP/3") {
+		t.Errorf("summary = %q; want a timeline with the upgrade", out)
+	}
+}
+
+// captureStdout returns what fn prints to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	fn()
+	_ = w.Close()
+	return <-done
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Max response body read for --expect-body
+const maxExpectBody = 1 << 20
+
+// expectations are the response checks from --expect-status,
+// --expect-body and --expect-header. A response that fails one is an
+// assertion failure: drawn with its own glyph, counted apart from network
+// failures, but still DOWN.
+type expectations struct {
+	status  [][2]int // inclusive ranges; empty = any status
+	body    *regexp.Regexp
+	headers []headerMatch
+}
+
+// headerMatch requires a response header; an empty value only checks
+// that it is present.
+type headerMatch struct {
+	name  string
+	value string
+}
+
+// assertError reports a response that arrived but failed an expectation.
+type assertError struct {
+	msg string
+}
+
+func (e *assertError) Error() string { return e.msg }
+
+// isAssertError reports whether err is an assertion failure rather than a
+// network or protocol error.
+func isAssertError(err error) bool {
+	var ae *assertError
+	return errors.As(err, &ae)
+}
+
+// newExpectations parses the --expect-* flags. It returns nil when none
+// is set, so the response body is never read needlessly.
+func newExpectations(status, body string, headers []string) (*expectations, error) {
+	if status == "" && body == "" && len(headers) == 0 {
+		return nil, nil
+	}
+	e := &expectations{}
+	if status != "" {
+		for _, part := range strings.Split(status, ",") {
+			lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+			from, err1 := strconv.Atoi(lo)
+			to, err2 := from, error(nil)
+			if isRange {
+				to, err2 = strconv.Atoi(hi)
+			}
+			if err1 != nil || err2 != nil || from < 100 || to > 599 || from > to {
+				return nil, fmt.Errorf("invalid --expect-status %q (want e.g. 200-299,301)", status)
+			}
+			e.status = append(e.status, [2]int{from, to})
+		}
+	}
+	if body != "" {
+		re, err := regexp.Compile(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --expect-body: %v", err)
+		}
+		e.body = re
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("invalid --expect-header %q (want \"Name: value\" or \"Name\")", h)
+		}
+		e.headers = append(e.headers, headerMatch{name: name, value: strings.TrimSpace(value)})
+	}
+	return e, nil
+}
+
+// check validates resp, reading at most maxExpectBody bytes of the body
+// when a body regex is set. It returns an *assertError on mismatch.
+func (e *expectations) check(resp *http.Response) error {
+	if len(e.status) > 0 {
+		ok := false
+		for _, r := range e.status {
+			if resp.StatusCode >= r[0] && resp.StatusCode <= r[1] {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return &assertError{fmt.Sprintf("unexpected status %d", resp.StatusCode)}
+		}
+	}
+	for _, h := range e.headers {
+		values, ok := resp.Header[http.CanonicalHeaderKey(h.name)]
+		if !ok {
+			return &assertError{fmt.Sprintf("missing header %s", h.name)}
+		}
+		if h.value != "" && !slices.Contains(values, h.value) {
+			return &assertError{fmt.Sprintf("header %s: got %q, want %q", h.name, strings.Join(values, ", "), h.value)}
+		}
+	}
+	if e.body != nil {
+		b, err := io.ReadAll(io.LimitReader(resp.Body, maxExpectBody))
+		if err != nil {
+			return err
+		}
+		if !e.body.Match(b) {
+			return &assertError{fmt.Sprintf("body does not match %q", e.body)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: response expectations
+// =============================================================================
+
+func TestNewExpectations(t *testing.T) {
+	if e, err := newExpectations("", "", nil); e != nil || err != nil {
+		t.Errorf("no flags = %v, %v; want nil, nil", e, err)
+	}
+	e, err := newExpectations("200-299, 301", "ok", []string{"X-Foo: bar", "X-Present"})
+	if err != nil {
+		t.Fatalf("newExpectations: %v", err)
+	}
+	if len(e.status) != 2 || e.status[0] != [2]int{200, 299} || e.status[1] != [2]int{301, 301} {
+		t.Errorf("status = %v", e.status)
+	}
+	if len(e.headers) != 2 || e.headers[0] != (headerMatch{"X-Foo", "bar"}) || e.headers[1] != (headerMatch{"X-Present", ""}) {
+		t.Errorf("headers = %v", e.headers)
+	}
+
+	for _, bad := range []struct{ status, body, header string }{
+		{status: "abc"},
+		{status: "299-200"},
+		{status: "99"},
+		{status: "200-600"},
+		{body: "("},
+		{header: ": bar"},
+	} {
+		var headers []string
+		if bad.header != "" {
+			headers = []string{bad.header}
+		}
+		if _, err := newExpectations(bad.status, bad.body, headers); err == nil {
+			t.Errorf("newExpectations(%q, %q, %q) accepted", bad.status, bad.body, bad.header)
+		}
+	}
+}
+
+func TestExpectations_Check(t *testing.T) {
+	resp := func(status int, body string, header ...string) *http.Response {
+		r := &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Add(header[i], header[i+1])
+		}
+		return r
+	}
+	tests := []struct {
+		name    string
+		status  string
+		body    string
+		headers []string
+		resp    *http.Response
+		wantErr string
+	}{
+		{"status in range", "200-299", "", nil, resp(204, ""), ""},
+		{"status list", "200,301", "", nil, resp(301, ""), ""},
+		{"status out of range", "200-299", "", nil, resp(503, ""), "unexpected status 503"},
+		{"body matches", "", `"status":\s*"ok"`, nil, resp(200, `{"status": "ok"}`), ""},
+		{"body mismatch", "", "ok", nil, resp(200, "degraded"), "body does not match"},
+		{"header value", "", "", []string{"X-Foo: bar"}, resp(200, "", "X-Foo", "bar"), ""},
+		{"header wrong value", "", "", []string{"X-Foo: bar"}, resp(200, "", "X-Foo", "baz"), `header X-Foo: got "baz", want "bar"`},
+		{"header missing", "", "", []string{"x-foo"}, resp(200, ""), "missing header x-foo"},
+		{"header present", "", "", []string{"X-Foo"}, resp(200, "", "X-Foo", "anything"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newExpectations(tt.status, tt.body, tt.headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = e.check(tt.resp)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("check = %v; want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !isAssertError(err) {
+				t.Errorf("check = %v; want assertion error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsAssertError(t *testing.T) {
+	if isAssertError(nil) || isAssertError(errors.New("timeout")) {
+		t.Error("plain errors reported as assertion failures")
+	}
+	if !isAssertError(fmt.Errorf("wrapped: %w", &assertError{"x"})) {
+		t.Error("wrapped assertion error not detected")
+	}
+}
+
+func TestRecordResult_CountsInvalidSeparately(t *testing.T) {
+	s := &stats{min: time.Hour}
+	recordResult(s, 10*time.Millisecond, phases{}, nil)
+	recordResult(s, 5*time.Millisecond, phases{}, &assertError{"unexpected status 503"})
+	recordResult(s, 0, phases{}, errors.New("timeout"))
+
+	if s.count != 1 || s.failures != 2 || s.invalid != 1 {
+		t.Errorf("count/failures/invalid = %d/%d/%d; want 1/2/1", s.count, s.failures, s.invalid)
+	}
+	if s.blocks[1] != invalidBlock || !strings.Contains(s.blocks[2], "!") {
+		t.Errorf("blocks = %q; want invalid glyph then !", s.blocks)
+	}
+	// A fast 503 is DOWN: the period flipped and stays down
+	if len(s.periods) != 1 || s.currentPeriod.up || s.currentPeriod.count != 2 {
+		t.Errorf("periods = %v, current = %+v; want one UP then DOWN x2", s.periods, s.currentPeriod)
+	}
+	if !strings.Contains(formatStats(s), "1 invalid") {
+		t.Errorf("formatStats = %q; want invalid count", formatStats(s))
+	}
+}
+
+func TestGetBrailleChar_Invalid(t *testing.T) {
+	if got := getBrailleChar(rttInvalid, rttInvalid); got != invalidBlock {
+		t.Errorf("two invalid = %q; want invalid glyph", got)
+	}
+	if got := getBrailleChar(rttInvalid, rttFailed); !strings.Contains(got, "!") {
+		t.Errorf("invalid + failure = %q; want !", got)
+	}
+}
+
+func TestMeasureRTT_ExpectStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	rs, _ := newRequestSpec("", nil, "", "", "")
+	rs.expect, _ = newExpectations("200-299", "", nil)
+	client := createClient(protoHTTP1, &options{timeout: 5 * time.Second})
+	m, err := measureRTT(client, srv.URL, protoHTTP1, rs)
+	if !isAssertError(err) {
+		t.Fatalf("err = %v; want assertion error", err)
+	}
+	if m.status != 503 || m.rtt <= 0 {
+		t.Errorf("measurement = %+v; want status 503 with RTT", m)
+	}
+}
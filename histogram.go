@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// Log-linear bucketing: values below histSub microseconds get one bucket
+// each; above that every power of two is split into histSub buckets, so
+// the relative error stays under 1/(2*histSub) at any scale.
+const (
+	histSubBits = 5
+	histSub     = 1 << histSubBits
+)
+
+// latencyHist is an HDR-style latency histogram with microsecond
+// resolution. Memory grows with log2 of the largest value (under 1000
+// buckets for an hour), not with the number of samples.
+type latencyHist struct {
+	counts []uint64
+	n      uint64
+	sum    float64 // microseconds
+	sumSq  float64 // microseconds²
+}
+
+// histBucket returns the bucket index for a value in microseconds.
+func histBucket(us uint64) int {
+	if us < histSub {
+		return int(us)
+	}
+	shift := bits.Len64(us) - histSubBits - 1
+	return (shift+1)*histSub + int(us>>shift) - histSub
+}
+
+// histBucketBounds returns the [lo, hi) range of bucket i in microseconds.
+func histBucketBounds(i int) (lo, hi uint64) {
+	if i < histSub {
+		return uint64(i), uint64(i) + 1
+	}
+	shift := i/histSub - 1
+	lo = uint64(i%histSub+histSub) << shift
+	return lo, lo + 1<<shift
+}
+
+// histValue is the representative (midpoint) value of bucket i.
+func histValue(i int) time.Duration {
+	lo, hi := histBucketBounds(i)
+	return time.Duration(lo+(hi-lo)/2) * time.Microsecond
+}
+
+func (h *latencyHist) record(d time.Duration) {
+	us := uint64(max(d.Microseconds(), 0))
+	i := histBucket(us)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	h.n++
+	h.sum += float64(us)
+	h.sumSq += float64(us) * float64(us)
+}
+
+// quantile returns the value at fraction q (0..1) of the recorded samples.
+func (h *latencyHist) quantile(q float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.n)))
+	rank = max(rank, 1)
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return histValue(i)
+		}
+	}
+	return histValue(len(h.counts) - 1)
+}
+
+// stddev is the sample standard deviation, computed exactly from the sums.
+func (h *latencyHist) stddev() time.Duration {
+	if h.n < 2 {
+		return 0
+	}
+	n := float64(h.n)
+	v := (h.sumSq - h.sum*h.sum/n) / (n - 1)
+	return time.Duration(math.Sqrt(max(v, 0)) * float64(time.Microsecond))
+}
+
+// mdev is ping's mdev: the population standard deviation,
+// sqrt(Σx²/n − avg²), computed exactly from the sums.
+func (h *latencyHist) mdev() time.Duration {
+	if h.n < 2 {
+		return 0
+	}
+	n := float64(h.n)
+	avg := h.sum / n
+	v := h.sumSq/n - avg*avg
+	return time.Duration(math.Sqrt(max(v, 0)) * float64(time.Microsecond))
+}
+
+// percentile returns the q quantile of the successful RTTs in s, clamped
+// to the exact min/max so bucket midpoints never fall outside them.
+func percentile(s *stats, q float64) time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return min(max(s.hist.quantile(q), s.min), s.max)
+}
+
+// percentileLine formats p50/p90/p95/p99 plus stddev/mdev for printFinal.
+func percentileLine(s *stats) string {
+	return fmt.Sprintf("p50/p90/p95/p99 = %d/%d/%d/%d ms, stddev/mdev = %s/%s ms",
+		percentile(s, 0.50).Milliseconds(), percentile(s, 0.90).Milliseconds(),
+		percentile(s, 0.95).Milliseconds(), percentile(s, 0.99).Milliseconds(),
+		fmtMs(s.hist.stddev()), fmtMs(s.hist.mdev()))
+}
+
+// fmtMs formats d in milliseconds, with one decimal below 10ms.
+func fmtMs(d time.Duration) string {
+	if d < 10*time.Millisecond {
+		return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%d", d.Milliseconds())
+}
+
+// histogramLines renders h as up to rows horizontal bars over
+// log-spaced ranges between lo and hi. Each row is labelled with its
+// upper bound and colored by the latency zone of that bound. Rows whose
+// bounds print the same are merged, so a narrow range gets fewer rows.
+func histogramLines(h *latencyHist, lo, hi time.Duration, rows, width int) []string {
+	if h.n == 0 || rows < 1 {
+		return nil
+	}
+	lo = max(lo, time.Microsecond)
+	hi = max(hi, lo)
+	if hi == lo {
+		rows = 1
+	}
+
+	var edges []time.Duration
+	ratio := float64(hi) / float64(lo)
+	for r := range rows {
+		e := time.Duration(float64(lo) * math.Pow(ratio, float64(r+1)/float64(rows)))
+		if r == rows-1 {
+			e = hi
+		}
+		if n := len(edges); n > 0 && fmtMs(edges[n-1]) == fmtMs(e) {
+			edges[n-1] = e // same label: widen the previous row
+			continue
+		}
+		edges = append(edges, e)
+	}
+	rows = len(edges)
+
+	counts := make([]uint64, rows)
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		v := histValue(i)
+		r := 0
+		for r < rows-1 && v > edges[r] {
+			r++
+		}
+		counts[r] += c
+	}
+	var peak uint64
+	for _, c := range counts {
+		peak = max(peak, c)
+	}
+
+	lines := make([]string, rows)
+	for r, c := range counts {
+		n := int(c * uint64(width) / peak)
+		bar := strings.Repeat("█", n)
+		if c > 0 && n == 0 {
+			bar = "▏"
+		}
+		color := red
+		if ms := edges[r].Milliseconds(); ms < greenThreshold {
+			color = green
+		} else if ms < yellowThreshold {
+			color = yellow
+		}
+		lines[r] = fmt.Sprintf("  ≤%6sms %s%-*s%s %d", fmtMs(edges[r]), color, width, bar, reset, c)
+	}
+	return lines
+}
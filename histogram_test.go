@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: latency histogram
+// =============================================================================
+
+func TestHistBucket_BoundsContainValue(t *testing.T) {
+	for _, us := range []uint64{0, 1, 31, 32, 33, 63, 64, 65, 127, 128, 1000, 12345, 999999, 3600000000} {
+		i := histBucket(us)
+		lo, hi := histBucketBounds(i)
+		if us < lo || us >= hi {
+			t.Errorf("histBucket(%d) = %d with bounds [%d, %d)", us, i, lo, hi)
+		}
+		// Relative bucket width stays within 1/histSub
+		if us >= histSub && float64(hi-lo)/float64(lo) > 1.0/histSub {
+			t.Errorf("bucket %d [%d, %d) too wide", i, lo, hi)
+		}
+	}
+}
+
+func TestHistBucket_Monotonic(t *testing.T) {
+	prev := -1
+	for us := uint64(0); us < 100000; us += 7 {
+		i := histBucket(us)
+		if i < prev {
+			t.Fatalf("histBucket(%d) = %d < previous %d", us, i, prev)
+		}
+		prev = i
+	}
+}
+
+func TestLatencyHist_Quantile(t *testing.T) {
+	var h latencyHist
+	// 1ms..1000ms uniformly
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.50, 500 * time.Millisecond},
+		{0.90, 900 * time.Millisecond},
+		{0.95, 950 * time.Millisecond},
+		{0.99, 990 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got := h.quantile(tt.q)
+		if diff := math.Abs(float64(got-tt.want)) / float64(tt.want); diff > 0.02 {
+			t.Errorf("quantile(%v) = %v; want %v ±2%%", tt.q, got, tt.want)
+		}
+	}
+	if got := new(latencyHist).quantile(0.5); got != 0 {
+		t.Errorf("empty quantile = %v; want 0", got)
+	}
+}
+
+func TestLatencyHist_Deviation(t *testing.T) {
+	var h latencyHist
+	for _, ms := range []int{10, 20, 30, 40} {
+		h.record(time.Duration(ms) * time.Millisecond)
+	}
+	// Sample stddev of 10,20,30,40 = 12.91ms; population stddev (ping's mdev) = 11.18ms
+	if got := h.stddev(); got < 12900*time.Microsecond || got > 12920*time.Microsecond {
+		t.Errorf("stddev = %v; want ~12.91ms", got)
+	}
+	if got := h.mdev(); got < 11170*time.Microsecond || got > 11190*time.Microsecond {
+		t.Errorf("mdev = %v; want ~11.18ms", got)
+	}
+	var one latencyHist
+	one.record(5 * time.Millisecond)
+	if one.stddev() != 0 || one.mdev() != 0 {
+		t.Errorf("single sample: stddev = %v, mdev = %v; want 0, 0", one.stddev(), one.mdev())
+	}
+}
+
+func TestPercentile_ClampedToMinMax(t *testing.T) {
+	s := &stats{min: time.Hour}
+	for _, d := range []time.Duration{1001 * time.Microsecond, 1001 * time.Microsecond} {
+		recordResult(s, d, phases{}, nil)
+	}
+	if got := percentile(s, 0.99); got != 1001*time.Microsecond {
+		t.Errorf("percentile = %v; want exact 1.001ms", got)
+	}
+	if got := percentile(&stats{min: time.Hour}, 0.5); got != 0 {
+		t.Errorf("percentile without samples = %v; want 0", got)
+	}
+}
+
+func TestPercentileLine(t *testing.T) {
+	s := &stats{min: time.Hour}
+	for _, ms := range []int{10, 20, 30, 40} {
+		recordResult(s, time.Duration(ms)*time.Millisecond, phases{}, nil)
+	}
+	want := "p50/p90/p95/p99 = 20/40/40/40 ms, stddev/mdev = 12/"
+	if got := percentileLine(s); !strings.HasPrefix(got, want) {
+		t.Errorf("percentileLine = %q; want prefix %q", got, want)
+	}
+}
+
+func TestHistogramLines(t *testing.T) {
+	var h latencyHist
+	for i := 0; i < 90; i++ {
+		h.record(20 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.record(800 * time.Millisecond)
+	}
+	lines := histogramLines(&h, 20*time.Millisecond, 800*time.Millisecond, 4, 10)
+	if len(lines) != 4 {
+		t.Fatalf("lines = %d; want 4", len(lines))
+	}
+	if !strings.Contains(lines[0], strings.Repeat("█", 10)) || !strings.HasSuffix(lines[0], " 90") {
+		t.Errorf("first row = %q; want full bar with 90", lines[0])
+	}
+	if !strings.Contains(lines[3], "800ms") || !strings.HasSuffix(lines[3], " 10") {
+		t.Errorf("last row = %q; want ≤800ms with 10", lines[3])
+	}
+	if !strings.HasSuffix(lines[1], " 0") || !strings.HasSuffix(lines[2], " 0") {
+		t.Errorf("middle rows = %q, %q; want empty", lines[1], lines[2])
+	}
+
+	// All samples equal: a single row
+	var same latencyHist
+	same.record(5 * time.Millisecond)
+	same.record(5 * time.Millisecond)
+	if got := histogramLines(&same, 5*time.Millisecond, 5*time.Millisecond, 8, 10); len(got) != 1 {
+		t.Errorf("equal samples: %d rows; want 1", len(got))
+	}
+	// Narrow range: no two rows share a label
+	var narrow latencyHist
+	for _, us := range []int{2150, 2230, 2310, 2390, 2480} {
+		narrow.record(time.Duration(us) * time.Microsecond)
+	}
+	got := histogramLines(&narrow, 2150*time.Microsecond, 2480*time.Microsecond, 8, 10)
+	seen := map[string]bool{}
+	total := 0
+	for _, line := range got {
+		label := strings.Fields(line)[1]
+		if seen[label] {
+			t.Errorf("narrow range: label %s repeated in %q", label, got)
+		}
+		seen[label] = true
+		n, _ := strconv.Atoi(line[strings.LastIndex(line, " ")+1:])
+		total += n
+	}
+	if len(got) >= 8 || total != 5 {
+		t.Errorf("narrow range: %d rows counting %d samples; want fewer than 8 rows counting 5", len(got), total)
+	}
+	if got := histogramLines(new(latencyHist), 0, 0, 8, 10); got != nil {
+		t.Errorf("empty histogram = %v; want nil", got)
+	}
+}
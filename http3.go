@@ -1,23 +1,39 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"net/http"
-	"time"
 
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 )
 
-func newHTTP3Client(timeout time.Duration, insecure bool) *http.Client {
+func newHTTP3Client(o *options) *http.Client {
+	transport := &http3.Transport{
+		TLSClientConfig: o.tlsConfig(),
+	}
+	if o.overrides != nil || o.family != 0 {
+		transport.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			return dialQUIC(ctx, o, addr, tlsCfg, cfg)
+		}
+	}
 	return &http.Client{
-		Timeout: timeout,
-		Transport: &http3.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: insecure,
-			},
-		},
+		Timeout:   o.timeout,
+		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
 }
+
+// newAltSvcClient returns an HTTP/3 client that dials addr, an Alt-Svc
+// alternative, instead of the URL's host. Requests (and the certificate
+// check) still name the origin. Dial overrides and -4/-6 apply to addr.
+func newAltSvcClient(o *options, addr string) *http.Client {
+	c := newHTTP3Client(o)
+	c.Transport.(*http3.Transport).Dial = func(ctx context.Context, _ string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		return dialQUIC(ctx, o, addr, tlsCfg, cfg)
+	}
+	return c
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"math"
+	"time"
+)
+
+// jsonPhases is the per-phase breakdown in JSON records (milliseconds).
+type jsonPhases struct {
+	DNS     float64 `json:"dns_ms"`
+	Connect float64 `json:"connect_ms"`
+	TLS     float64 `json:"tls_ms"`
+	TTFB    float64 `json:"ttfb_ms"`
+}
+
+// jsonProbe is emitted once per probe. Transition is set on the first
+// probe of a new UP/DOWN period (not on the very first probe).
+type jsonProbe struct {
+	Type       string      `json:"type"`
+	Time       time.Time   `json:"time"`
+	Seq        int         `json:"seq"`
+	Target     string      `json:"target"`
+	Protocol   string      `json:"protocol"`
+	Family     string      `json:"family,omitempty"`
+	Address    string      `json:"address,omitempty"` // IP that carried the request
+	RTT        float64     `json:"rtt_ms"`
+	Status     int         `json:"status,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Invalid    bool        `json:"invalid,omitempty"`
+	Reused     bool        `json:"reused,omitempty"`
+	Phases     *jsonPhases `json:"phases,omitempty"`
+	State      string      `json:"state"`
+	Transition bool        `json:"transition,omitempty"`
+	Warmup     bool        `json:"warmup,omitempty"` // --warmup probe, left out of the summary
+}
+
+// jsonEvent reports a protocol change for a target.
+type jsonEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Target   string    `json:"target"`
+	Protocol string    `json:"protocol"`
+	From     string    `json:"from"`
+}
+
+// jsonCertChange reports a leaf certificate rotation (SHA-256 fingerprints).
+type jsonCertChange struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Target   string    `json:"target"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// jsonAltSvc reports a change in a target's Alt-Svc HTTP/3
+// advertisement; H3 is empty once it is withdrawn.
+type jsonAltSvc struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Target string    `json:"target"`
+	H3     string    `json:"h3,omitempty"` // address to dial, host:port
+	MaxAge float64   `json:"max_age_s,omitempty"`
+}
+
+// jsonTLS is the last seen TLS state in the summary.
+type jsonTLS struct {
+	Version     string    `json:"version"`
+	Cipher      string    `json:"cipher"`
+	ALPN        string    `json:"alpn,omitempty"`
+	Chain       []string  `json:"chain,omitempty"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"sha256"`
+	Expiring    bool      `json:"expiring,omitempty"` // within --cert-warn
+	Changes     int       `json:"cert_changes,omitempty"`
+}
+
+type jsonPeriod struct {
+	State    string    `json:"state"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration_ms"`
+	Count    int       `json:"count"`
+	Invalid  int       `json:"invalid,omitempty"` // DOWN probes that failed an --expect-* check
+}
+
+// jsonSummary replaces printFinal: one object per target at exit.
+type jsonSummary struct {
+	Type     string       `json:"type"`
+	Target   string       `json:"target"`
+	Protocol string       `json:"protocol"`
+	Family   string       `json:"family,omitempty"`
+	Requests int          `json:"requests"`
+	OK       int          `json:"ok"`
+	Failed   int          `json:"failed"`
+	Invalid  int          `json:"invalid"`
+	LossPct  float64      `json:"loss_pct"`
+	Min      float64      `json:"min_ms"`
+	Avg      float64      `json:"avg_ms"`
+	Max      float64      `json:"max_ms"`
+	P50      float64      `json:"p50_ms"`
+	P90      float64      `json:"p90_ms"`
+	P95      float64      `json:"p95_ms"`
+	P99      float64      `json:"p99_ms"`
+	StdDev   float64      `json:"stddev_ms"`
+	MDev     float64      `json:"mdev_ms"`
+	Phases   *jsonPhases  `json:"phases_avg,omitempty"`
+	TLS      *jsonTLS     `json:"tls,omitempty"`
+	Periods  []jsonPeriod `json:"periods"`
+	Breaches []string     `json:"slo_breaches,omitempty"`
+}
+
+// ms converts d to fractional milliseconds with microsecond precision.
+func ms(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+func toJSONPhases(p phases) *jsonPhases {
+	return &jsonPhases{DNS: ms(p.dns), Connect: ms(p.connect), TLS: ms(p.tls), TTFB: ms(p.ttfb)}
+}
+
+func stateName(up bool) string {
+	if up {
+		return "up"
+	}
+	return "down"
+}
+
+// jsonView writes newline-delimited JSON records instead of drawing bars.
+type jsonView struct {
+	targets []*target
+	slo     slo
+	enc     *json.Encoder
+}
+
+func newJSONView(targets []*target, lim slo, w io.Writer) *jsonView {
+	return &jsonView{targets: targets, slo: lim, enc: json.NewEncoder(w)}
+}
+
+func (v *jsonView) start()   {}
+func (v *jsonView) redraw()  {}
+func (v *jsonView) refresh() {}
+func (v *jsonView) resize()  {}
+
+func (v *jsonView) update(r result) {
+	if r.switched {
+		_ = v.enc.Encode(jsonEvent{Type: switchName(r), Time: r.at, Target: r.t.displayURL, Protocol: protoNames[r.proto], From: protoNames[r.from]})
+		return
+	}
+	_ = v.enc.Encode(probeRecord(r))
+	r.t.noteDialed(r.remote) // the summary reports its family
+	if r.t.noteAltSvc(r.altSvc) {
+		ev := jsonAltSvc{Type: "alt_svc", Time: r.at, Target: r.t.displayURL}
+		if a := r.t.h3; a != nil {
+			ev.H3, ev.MaxAge = a.authority(r.t.host), a.maxAge.Seconds()
+		}
+		_ = v.enc.Encode(ev)
+	}
+	if c := rotation(r); c != nil {
+		_ = v.enc.Encode(jsonCertChange{Type: "cert_change", Time: r.at, Target: r.t.displayURL, From: c.from.fingerprint, To: c.to.fingerprint, NotAfter: c.to.notAfter})
+	}
+}
+
+// probeRecord builds the JSON record for a probe result that has already
+// been recorded in r.t.s.
+func probeRecord(r result) jsonProbe {
+	s := r.t.s
+	rec := jsonProbe{
+		Type:     "probe",
+		Time:     r.at,
+		Seq:      r.seq,
+		Target:   r.t.displayURL,
+		Protocol: protoNames[r.proto],
+		Family:   familyName(probeFamily(r)),
+		Address:  r.remote,
+		Status:   r.status,
+		State:    stateName(r.err == nil),
+		Warmup:   r.warmup,
+	}
+	if isAssertError(r.err) {
+		// The response arrived, so its timing is still reported
+		rec.Error = r.err.Error()
+		rec.Invalid = true
+		rec.RTT = ms(r.rtt)
+	} else if r.err != nil {
+		rec.Error = r.err.Error()
+	} else {
+		rec.RTT = ms(r.rtt)
+		rec.Phases = toJSONPhases(r.ph)
+		rec.Reused = r.ph.reused
+	}
+	if !r.warmup && s.currentPeriod != nil && s.currentPeriod.count == 1 && len(s.periods) > 0 {
+		rec.Transition = true
+	}
+	return rec
+}
+
+func (v *jsonView) final() {
+	now := clock()
+	for _, t := range v.targets {
+		rec := summaryRecord(t, now)
+		_, rec.Breaches = v.slo.check(t.s)
+		_ = v.enc.Encode(rec)
+	}
+}
+
+// summaryRecord builds the end-of-run JSON object for t. Periods must
+// already be closed.
+func summaryRecord(t *target, now time.Time) jsonSummary {
+	s := t.s
+	total := s.count + s.failures
+	sum := jsonSummary{
+		Type:     "summary",
+		Target:   t.displayURL,
+		Protocol: protoNames[t.proto],
+		Family:   familyName(t.addrFamily()),
+		Requests: total,
+		OK:       s.count,
+		Failed:   s.failures,
+		Invalid:  s.invalid,
+		Periods:  []jsonPeriod{},
+	}
+	if total > 0 {
+		sum.LossPct = math.Round(float64(s.failures)*10000/float64(total)) / 100
+	}
+	if s.count > 0 {
+		sum.Min = ms(s.min)
+		sum.Avg = ms(s.total / time.Duration(s.count))
+		sum.Max = ms(s.max)
+		sum.P50 = ms(percentile(s, 0.50))
+		sum.P90 = ms(percentile(s, 0.90))
+		sum.P95 = ms(percentile(s, 0.95))
+		sum.P99 = ms(percentile(s, 0.99))
+		sum.StdDev = ms(s.hist.stddev())
+		sum.MDev = ms(s.hist.mdev())
+		sum.Phases = toJSONPhases(s.phaseTotal.div(s.count))
+	}
+	if s.tls != nil {
+		sum.TLS = &jsonTLS{
+			Version:     tls.VersionName(s.tls.version),
+			Cipher:      tls.CipherSuiteName(s.tls.cipher),
+			ALPN:        s.tls.alpn,
+			Chain:       s.tls.chain,
+			NotAfter:    s.tls.notAfter,
+			Fingerprint: s.tls.fingerprint,
+			Expiring:    certExpiring(s, now),
+			Changes:     len(s.certChanges),
+		}
+	}
+	for i, p := range s.periods {
+		end := now
+		if i+1 < len(s.periods) {
+			end = s.periods[i+1].start
+		}
+		sum.Periods = append(sum.Periods, jsonPeriod{
+			State:    stateName(p.up),
+			Start:    p.start,
+			Duration: ms(end.Sub(p.start)),
+			Count:    p.count,
+			Invalid:  p.invalid,
+		})
+	}
+	return sum
+}
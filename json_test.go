@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: JSON output records
+// =============================================================================
+
+func TestProbeRecord_MarksTransitions(t *testing.T) {
+	tg := &target{displayURL: "example.com", s: &stats{min: time.Hour}}
+	outcomes := []error{nil, nil, errors.New("timeout"), errors.New("timeout"), nil}
+	wantTransition := []bool{false, false, true, false, true}
+
+	for i, err := range outcomes {
+		r := result{t: tg, seq: i + 1, err: err, proto: protoHTTPS}
+		if err == nil {
+			r.rtt = 20 * time.Millisecond
+			r.status = 200
+		}
+		recordResult(tg.s, r.rtt, r.ph, r.err)
+		rec := probeRecord(r)
+		if rec.Transition != wantTransition[i] {
+			t.Errorf("probe %d: transition = %v; want %v", i+1, rec.Transition, wantTransition[i])
+		}
+		if (err == nil) != (rec.State == "up") {
+			t.Errorf("probe %d: state = %q with err = %v", i+1, rec.State, err)
+		}
+		if err != nil && (rec.Error != "timeout" || rec.Phases != nil) {
+			t.Errorf("probe %d: error = %q, phases = %v; want timeout, nil", i+1, rec.Error, rec.Phases)
+		}
+	}
+}
+
+func TestJSONView_WritesNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	tg := &target{displayURL: "example.com", proto: protoHTTPS, s: &stats{min: time.Hour}}
+	v := newJSONView([]*target{tg}, slo{}, &buf)
+
+	r := result{t: tg, seq: 1, proto: protoHTTPS, measurement: measurement{rtt: 1500 * time.Microsecond, status: 204}}
+	recordResult(tg.s, r.rtt, r.ph, r.err)
+	v.update(r)
+	v.update(result{t: tg, proto: protoHTTP2, switched: true, from: protoHTTP3})
+	closePeriods(tg.s)
+	v.final()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("lines = %d; want 3:\n%s", len(lines), buf.String())
+	}
+	wantTypes := []string{"probe", "downgrade", "summary"}
+	for i, line := range lines {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %d is not valid JSON: %v", i+1, err)
+		}
+		if rec["type"] != wantTypes[i] {
+			t.Errorf("line %d type = %v; want %s", i+1, rec["type"], wantTypes[i])
+		}
+	}
+	if !strings.Contains(lines[0], `"rtt_ms":1.5`) || !strings.Contains(lines[0], `"status":204`) {
+		t.Errorf("probe line = %s; want rtt_ms 1.5 and status 204", lines[0])
+	}
+	if !strings.Contains(lines[1], `"protocol":"HTTP/2","from":"HTTP/3"`) {
+		t.Errorf("downgrade line = %s; want protocol HTTP/2 from HTTP/3", lines[1])
+	}
+}
+
+func TestSummaryRecord(t *testing.T) {
+	tg := &target{displayURL: "example.com", proto: protoHTTP3, s: &stats{min: time.Hour}}
+	recordResult(tg.s, 10*time.Millisecond, phases{}, nil)
+	recordResult(tg.s, 0, phases{}, errors.New("timeout"))
+	recordResult(tg.s, 5*time.Millisecond, phases{}, &assertError{"unexpected status 503"})
+	recordResult(tg.s, 30*time.Millisecond, phases{}, nil)
+	closePeriods(tg.s)
+
+	sum := summaryRecord(tg, time.Now())
+	if sum.Requests != 4 || sum.OK != 2 || sum.Failed != 2 {
+		t.Errorf("requests/ok/failed = %d/%d/%d; want 4/2/2", sum.Requests, sum.OK, sum.Failed)
+	}
+	if sum.LossPct != 50 {
+		t.Errorf("loss_pct = %v; want 50", sum.LossPct)
+	}
+	if sum.Min != 10 || sum.Avg != 20 || sum.Max != 30 {
+		t.Errorf("min/avg/max = %v/%v/%v; want 10/20/30", sum.Min, sum.Avg, sum.Max)
+	}
+	if len(sum.Periods) != 3 || sum.Periods[1].State != "down" || sum.Periods[1].Count != 2 || sum.Periods[1].Invalid != 1 {
+		t.Errorf("periods = %+v; want up/down (2, 1 invalid)/up", sum.Periods)
+	}
+}
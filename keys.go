@@ -0,0 +1,180 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Interval steps used by the +/- keys
+var intervalSteps = []time.Duration{
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+	30 * time.Second, time.Minute,
+}
+
+// controls holds the settings that can change while running (from the
+// keyboard). Probe loops consult it before every request.
+type controls struct {
+	mu       sync.Mutex
+	paused   bool
+	resume   chan struct{} // closed when a pause ends
+	interval time.Duration
+}
+
+func newControls(interval time.Duration) *controls {
+	return &controls{interval: interval}
+}
+
+// resumed returns a channel that is closed when the current pause ends,
+// or nil while probing is not paused.
+func (c *controls) resumed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return nil
+	}
+	return c.resume
+}
+
+// togglePause pauses or resumes all probe loops and reports the new state.
+func (c *controls) togglePause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		close(c.resume)
+	} else {
+		c.resume = make(chan struct{})
+	}
+	c.paused = !c.paused
+	return c.paused
+}
+
+func (c *controls) getInterval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.interval
+}
+
+// stepInterval moves the interval one step up (dir > 0) or down the
+// intervalSteps ladder and returns the new value.
+func (c *controls) stepInterval(dir int) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if dir > 0 {
+		for _, d := range intervalSteps {
+			if d > c.interval {
+				c.interval = d
+				break
+			}
+		}
+	} else {
+		for i := len(intervalSteps) - 1; i >= 0; i-- {
+			if intervalSteps[i] < c.interval {
+				c.interval = intervalSteps[i]
+				break
+			}
+		}
+	}
+	return c.interval
+}
+
+// keyHandler applies interactive keypresses to the running session.
+type keyHandler struct {
+	targets []*target
+	v       view
+	ctl     *controls
+	quit    func() // print summary and exit; called with displayMu held
+}
+
+// run reads single keypresses from r until it is closed. The terminal is
+// already in non-canonical mode (see disableInputProcessing).
+func (h *keyHandler) run(r io.Reader) {
+	buf := make([]byte, 1)
+	for {
+		if n, err := r.Read(buf); err != nil || n == 0 {
+			return
+		}
+		displayMu.Lock()
+		h.handle(buf[0])
+		displayMu.Unlock()
+	}
+}
+
+// handle applies a single key. Caller must hold displayMu.
+func (h *keyHandler) handle(key byte) {
+	switch key {
+	case ' ':
+		paused := h.ctl.togglePause()
+		for _, t := range h.targets {
+			t.s.paused = paused
+		}
+	case 'r':
+		for _, t := range h.targets {
+			resetStats(t.s)
+		}
+	case 'b':
+		for _, t := range h.targets {
+			setBraille(t.s, !t.s.braille)
+		}
+	case 'l':
+		for _, t := range h.targets {
+			t.s.legend = !t.s.legend
+		}
+	case '+', '=':
+		d := h.ctl.stepInterval(1)
+		for _, t := range h.targets {
+			t.s.note = "interval " + d.String()
+		}
+	case '-', '_':
+		d := h.ctl.stepInterval(-1)
+		for _, t := range h.targets {
+			t.s.note = "interval " + d.String()
+		}
+	case 'q':
+		h.quit()
+		return
+	default:
+		return
+	}
+	h.v.refresh()
+}
+
+// resetStats clears counters, periods and the bar while keeping the
+// display settings of s.
+func resetStats(s *stats) {
+	*s = stats{
+		min:       time.Hour,
+		braille:   s.braille,
+		phaseBar:  s.phaseBar,
+		reuse:     s.reuse,
+		timeAxis:  s.timeAxis,
+		markEvery: s.markEvery,
+		certWarn:  s.certWarn,
+		tls:       s.tls, // so the next probe is not taken for a rotation
+		legend:    s.legend,
+		paused:    s.paused,
+		// Keep the legend line bookkeeping so it is cleared correctly
+		legendShown: s.legendShown,
+	}
+}
+
+// setBraille switches s between braille and block rendering. A pending
+// braille half is flushed as a block so no reading is lost.
+func setBraille(s *stats, on bool) {
+	if !on && s.braille && s.hasPending {
+		if s.pendingWarm {
+			addBlock(s, warmupBlock(s.pendingRTT), s.pendingAt)
+		} else if s.pendingRTT == rttInvalid {
+			addBlock(s, invalidBlock, s.pendingAt)
+		} else if s.pendingRTT < 0 {
+			addBlock(s, red+bold+"!"+reset, s.pendingAt)
+		} else if s.pendingNew {
+			addBlock(s, uline+getBlock(s.pendingRTT), s.pendingAt)
+		} else {
+			addBlock(s, getBlock(s.pendingRTT), s.pendingAt)
+		}
+		s.hasPending, s.pendingWarm = false, false
+	}
+	s.braille = on
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: interactive keyboard controls
+// =============================================================================
+
+// fakeView counts refresh calls and ignores everything else.
+type fakeView struct{ refreshes int }
+
+func (v *fakeView) start()          {}
+func (v *fakeView) update(r result) {}
+func (v *fakeView) redraw()         {}
+func (v *fakeView) refresh()        { v.refreshes++ }
+func (v *fakeView) resize()         {}
+func (v *fakeView) final()          {}
+
+func TestControls_StepInterval(t *testing.T) {
+	tests := []struct {
+		name  string
+		start time.Duration
+		dir   int
+		want  time.Duration
+	}{
+		{"up-from-step", time.Second, 1, 2 * time.Second},
+		{"down-from-step", time.Second, -1, 500 * time.Millisecond},
+		{"up-from-between", 1500 * time.Millisecond, 1, 2 * time.Second},
+		{"down-from-between", 1500 * time.Millisecond, -1, time.Second},
+		{"clamp-top", time.Minute, 1, time.Minute},
+		{"clamp-bottom", 100 * time.Millisecond, -1, 100 * time.Millisecond},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newControls(tc.start)
+			if got := c.stepInterval(tc.dir); got != tc.want {
+				t.Errorf("stepInterval(%d) from %v = %v; want %v", tc.dir, tc.start, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeyHandler_Handle(t *testing.T) {
+	newHandler := func() (*keyHandler, *fakeView, *bool) {
+		v := &fakeView{}
+		quit := false
+		tg := &target{s: &stats{min: time.Hour}}
+		return &keyHandler{targets: []*target{tg}, v: v, ctl: newControls(time.Second), quit: func() { quit = true }}, v, &quit
+	}
+
+	t.Run("space-pauses", func(t *testing.T) {
+		h, v, _ := newHandler()
+		h.handle(' ')
+		if !h.targets[0].s.paused || !h.ctl.paused || v.refreshes != 1 {
+			t.Errorf("paused = %v/%v, refreshes = %d; want true/true, 1", h.targets[0].s.paused, h.ctl.paused, v.refreshes)
+		}
+	})
+
+	t.Run("r-resets-stats", func(t *testing.T) {
+		h, _, _ := newHandler()
+		s := h.targets[0].s
+		s.braille = true
+		recordResult(s, 10*time.Millisecond, phases{}, nil)
+		recordResult(s, 10*time.Millisecond, phases{}, nil)
+		h.handle('r')
+		if s.count != 0 || len(s.blocks) != 0 || s.currentPeriod != nil || s.min != time.Hour {
+			t.Errorf("stats not reset: count=%d blocks=%d", s.count, len(s.blocks))
+		}
+		if !s.braille {
+			t.Error("reset should keep braille mode")
+		}
+	})
+
+	t.Run("b-toggles-braille", func(t *testing.T) {
+		h, _, _ := newHandler()
+		h.handle('b')
+		if !h.targets[0].s.braille {
+			t.Error("b should enable braille")
+		}
+	})
+
+	t.Run("l-toggles-legend", func(t *testing.T) {
+		h, _, _ := newHandler()
+		h.handle('l')
+		h.handle('l')
+		h.handle('l')
+		if !h.targets[0].s.legend {
+			t.Error("three presses of l should leave the legend on")
+		}
+	})
+
+	t.Run("plus-minus-change-interval", func(t *testing.T) {
+		h, _, _ := newHandler()
+		h.handle('+')
+		if got := h.ctl.getInterval(); got != 2*time.Second {
+			t.Errorf("interval = %v; want 2s", got)
+		}
+		h.handle('-')
+		h.handle('-')
+		if got := h.ctl.getInterval(); got != 500*time.Millisecond {
+			t.Errorf("interval = %v; want 500ms", got)
+		}
+		if h.targets[0].s.note != "interval 500ms" {
+			t.Errorf("note = %q; want interval 500ms", h.targets[0].s.note)
+		}
+	})
+
+	t.Run("q-quits", func(t *testing.T) {
+		h, v, quit := newHandler()
+		h.handle('q')
+		if !*quit || v.refreshes != 0 {
+			t.Errorf("quit = %v, refreshes = %d; want true, 0", *quit, v.refreshes)
+		}
+	})
+
+	t.Run("other-keys-ignored", func(t *testing.T) {
+		h, v, _ := newHandler()
+		h.handle('x')
+		if v.refreshes != 0 {
+			t.Errorf("refreshes = %d; want 0", v.refreshes)
+		}
+	})
+}
+
+func TestSetBraille_FlushesPendingHalf(t *testing.T) {
+	withThresholds(0, 150, 400, func() {
+		s := &stats{min: time.Hour, braille: true}
+		recordResult(s, 10*time.Millisecond, phases{}, nil)
+		setBraille(s, false)
+		if s.hasPending || len(s.blocks) != 1 || extractBlock(s.blocks[0]) != "▁" {
+			t.Errorf("pending = %v, blocks = %q; want flushed ▁ block", s.hasPending, s.blocks)
+		}
+	})
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
@@ -24,18 +26,28 @@ var displayMu sync.Mutex
 
 const version = "0.8.6"
 
-const (
-	// ANSI colors
+// ANSI colors and text attributes; emptied by setColor(false)
+var (
 	green   = "\033[32m"
 	yellow  = "\033[33m"
 	red     = "\033[31m"
 	gray    = "\033[90m"
+	cyan    = "\033[36m"
+	blue    = "\033[34m"
+	magenta = "\033[35m"
 	bold    = "\033[1m"
+	uline   = "\033[4m"
+	dim     = "\033[2m"
 	reset   = "\033[0m"
-	clearLn = "\033[K"
-	up      = "\033[A"
-	down    = "\033[B"
-	col0    = "\033[0G"
+)
+
+const (
+	// ANSI cursor control
+	clearLn    = "\033[K"
+	clearDn    = "\033[J" // clear from cursor to end of screen
+	up         = "\033[A"
+	down       = "\033[B"
+	col0       = "\033[0G"
 	hideCur    = "\033[?25l"
 	showCur    = "\033[?25h"
 	steadyCur  = "\033[2 q" // DECSCUSR: steady block cursor
@@ -51,6 +63,19 @@ var brailleLeft = []rune{0x00, 0x40, 0x44, 0x46, 0x47}
 // Braille dot patterns for right column (dots 4,5,6,8) - 5 height levels (0-4)
 var brailleRight = []rune{0x00, 0x80, 0xA0, 0xB0, 0xB8}
 
+// Pending braille readings without a latency
+const (
+	rttFailed  time.Duration = -1 // network or protocol failure
+	rttInvalid time.Duration = -2 // response failed an --expect-* check
+)
+
+// Max response body drained after a probe so keep-alive can reuse the
+// connection; larger bodies just close it
+const maxDrain = 64 << 10
+
+// Glyph for a response that failed an --expect-* check
+var invalidBlock = magenta + bold + "×" + reset
+
 // Protocol levels for downgrade feature
 const (
 	protoHTTP1 = 0 // Plain HTTP/1.1 (insecure)
@@ -73,6 +98,10 @@ var (
 	yellowThreshold int64 = 400
 )
 
+// clock timestamps UP/DOWN periods and ends the timeline; replay swaps it
+// for the recorded probe times (under displayMu).
+var clock = time.Now
+
 // getEnvInt returns the env var value as int64, or the default if not set/invalid
 func getEnvInt(key string, def int64) int64 {
 	if v := os.Getenv(key); v != "" {
@@ -83,42 +112,101 @@ func getEnvInt(key string, def int64) int64 {
 	return def
 }
 
+// parseUntil returns the next occurrence of the --until time of day
+// ("18:00" or "18:00:30") after now: later today, or else tomorrow.
+func parseUntil(v string, now time.Time) (time.Time, error) {
+	var tod time.Time
+	var err error
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if tod, err = time.Parse(layout, v); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --until %q (want HH:MM or HH:MM:SS)", v)
+	}
+	at := time.Date(now.Year(), now.Month(), now.Day(), tod.Hour(), tod.Minute(), tod.Second(), 0, now.Location())
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, nil
+}
+
 type period struct {
-	up    bool
-	start time.Time
-	count int
+	up      bool
+	start   time.Time
+	count   int
+	invalid int // DOWN probes that failed an --expect-* check rather than the network
+}
+
+// protoSwitch is a mid-session protocol change, shown in the timeline.
+type protoSwitch struct {
+	at       time.Time
+	from, to int
 }
 
 type stats struct {
 	count         int
-	failures      int
+	failures      int // all failed probes, including invalid
+	invalid       int // responses that failed an --expect-* check
 	total         time.Duration
 	min           time.Duration
 	max           time.Duration
 	last          time.Duration
+	hist          latencyHist   // distribution of successful RTTs (percentiles)
 	blocks        []string      // individual blocks for proper width handling
+	blockTimes    []time.Time   // when each block's (first) probe completed
 	col           int           // current column position on bar line
 	lastPrinted   int           // last block index printed
+	lineStart     int           // index of the first block on the current bar line
+	timeAxis      bool          // prefix each bar line with its start time
+	markEvery     time.Duration // draw a separator when the bar crosses a multiple of this
 	braille       bool          // braille mode enabled
 	pendingRTT    time.Duration // pending RTT for braille pairing (-1 = failure, 0 = none)
 	hasPending    bool          // whether there's a pending RTT
+	pendingAt     time.Time     // when the pending RTT was recorded
+	pendingNew    bool          // pending RTT ran on a new connection (--reuse)
+	pendingWarm   bool          // pending RTT is a --warmup probe
 	periods       []period      // completed UP/DOWN periods
+	switches      []protoSwitch // protocol downgrades and re-upgrades
 	currentPeriod *period       // active period (nil until first request)
+	lastPhases    phases        // phase breakdown of the last successful request
+	phaseTotal    phases        // summed phases of successful requests
+	phaseBar      bool          // show phases as a stacked bar instead of text
+	legend        bool          // show the legend below the stats line (toggled with l)
+	legendShown   bool          // legend line is currently on screen
+	paused        bool          // probing paused from the keyboard
+	note          string        // transient message for the stats line
+	reuse         bool          // keep-alive mode: split new vs reused connections
+	newConns      int           // successful samples that opened a new connection
+	newTotal      time.Duration // summed RTT of those samples
+	tls           *tlsInfo      // TLS state of the last successful probe (nil = none)
+	certChanges   []certChange  // leaf certificate rotations
+	certWarn      time.Duration // warn when the leaf expires within this (0 = never)
 }
 
-func recordPeriod(s *stats, up bool) {
-	now := time.Now()
-	if s.currentPeriod == nil {
+// recordPeriod counts a probe in the current UP/DOWN period, starting a
+// new one when the state flips. invalid marks a DOWN probe that failed an
+// --expect-* check.
+func recordPeriod(s *stats, up, invalid bool) {
+	now := clock()
+	if s.currentPeriod != nil && s.currentPeriod.up == up {
+		s.currentPeriod.count++
+	} else {
+		if s.currentPeriod != nil {
+			// State flipped — close current period and start new one
+			s.periods = append(s.periods, *s.currentPeriod)
+		}
 		s.currentPeriod = &period{up: up, start: now, count: 1}
-		return
 	}
-	if s.currentPeriod.up == up {
-		s.currentPeriod.count++
-		return
+	if invalid {
+		s.currentPeriod.invalid++
 	}
-	// State flipped — close current period and start new one
-	s.periods = append(s.periods, *s.currentPeriod)
-	s.currentPeriod = &period{up: up, start: now, count: 1}
+}
+
+// recordSwitch notes a protocol change for the timeline.
+func recordSwitch(s *stats, at time.Time, from, to int) {
+	s.switches = append(s.switches, protoSwitch{at: at, from: from, to: to})
 }
 
 func closePeriods(s *stats) {
@@ -132,115 +220,112 @@ func main() {
 	// Silence quic-go UDP buffer warnings that corrupt terminal display
 	log.SetOutput(io.Discard)
 
-	interval := flag.DurationP("interval", "i", time.Second, "interval between requests")
+	interval := flag.DurationP("interval", "i", time.Second, "interval between request starts")
 	jitter := flag.DurationP("jitter", "j", 0, "max random jitter to add to interval (e.g., 200ms, 3s)")
 	timeout := flag.DurationP("timeout", "t", 5*time.Second, "request timeout")
-	count := flag.IntP("count", "c", 0, "number of requests (0 = unlimited)")
+	count := flag.IntP("count", "c", 0, "number of requests per target (0 = unlimited)")
+	warmup := flag.Int("warmup", 0, "send N probes per target first, drawn dimmed and left out of the stats")
+	duration := flag.Duration("duration", 0, "stop after this long, e.g. 15m (0 = no limit)")
+	until := flag.String("until", "", "stop at this time of day, e.g. 18:00 (tomorrow if already past)")
+	maxInFlight := flag.Int("max-inflight", 8, "probes per target allowed in flight at once, so a slow response doesn't delay the next (1 = one at a time)")
 	showLegend := flag.Bool("legend", false, "show the legend line")
 	noHeader := flag.Bool("noheader", false, "hide the header line")
 	useBraille := flag.BoolP("braille", "b", false, "use braille visualization (2x density)")
+	showPhases := flag.Bool("phases", false, "show DNS/TCP/TLS/TTFB breakdown as a stacked bar")
+	timeAxis := flag.Bool("time-axis", false, "start each bar line with the time of its first probe")
+	markEvery := flag.Duration("mark-every", 0, "draw a faint separator in the bar at every multiple of this (e.g. 5m)")
 	quiet := flag.BoolP("quiet", "q", false, "hide header and legend")
 	silent := flag.BoolP("silent", "Q", false, "hide header, legend, and final stats")
 	minFlag := flag.Int64P("min", "m", 0, "min latency baseline in ms (env: HP_MIN)")
 	greenFlag := flag.Int64P("green", "g", 0, "green threshold in ms (env: HP_GREEN)")
 	yellowFlag := flag.Int64P("yellow", "y", 0, "yellow threshold in ms (env: HP_YELLOW)")
 	insecure := flag.BoolP("insecure", "k", false, "skip TLS certificate verification")
+	caCert := flag.String("cacert", "", "verify servers against the CA certificates in this PEM file")
+	clientCert := flag.String("cert", "", "client certificate (PEM) for mutual TLS")
+	clientKey := flag.String("key", "", "private key (PEM) for --cert (default: read from the --cert file)")
+	tlsMin := flag.String("tls-min", "", "minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	tlsMax := flag.String("tls-max", "", "maximum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	sni := flag.String("sni", "", "TLS server name to send and verify (default: the target host)")
+	certWarn := flag.String("cert-warn", "14d", "warn when the server certificate expires within this (e.g. 30d, 0 = never)")
 	useHTTP1 := flag.BoolP("http", "1", false, "use plain HTTP/1.1")
 	useHTTP2 := flag.BoolP("http2", "2", false, "force HTTP/2 (fail if not negotiated)")
 	useHTTP3 := flag.BoolP("http3", "3", false, "use HTTP/3 (QUIC)")
 	downgrade := flag.BoolP("downgrade", "d", false, "auto-downgrade protocol on failures (secure only)")
 	downgradeInsecure := flag.BoolP("downgrade-insecure", "D", false, "auto-downgrade including plain HTTP")
+	downAfter := flag.Int("downgrade-after", 3, "with -d/-D, consecutive failures that trigger a downgrade")
+	upgradeEvery := flag.Int("upgrade-every", 30, "after a downgrade or a failed --upgrade-h3, retry the higher protocol every N requests (0 = never)")
+	upgradeH3 := flag.Bool("upgrade-h3", false, "switch to HTTP/3 once a response advertises it via Alt-Svc")
+	resolve := flag.StringArray("resolve", nil, "connect to addr for host:port, keeping Host and SNI: \"host:port:addr\" (repeatable)")
+	connectTo := flag.StringArray("connect-to", nil, "connect to HOST2:PORT2 for requests to HOST1:PORT1: \"HOST1:PORT1:HOST2:PORT2\" (repeatable)")
+	jsonOut := flag.Bool("json", false, "print one JSON object per probe and a JSON summary (NDJSON)")
+	compare := flag.Bool("compare-protocols", false, "probe one target over HTTP/1.1, HTTPS, HTTP/2 and HTTP/3 side by side")
+	useIPv4 := flag.BoolP("ipv4", "4", false, "connect over IPv4 only")
+	useIPv6 := flag.BoolP("ipv6", "6", false, "connect over IPv6 only")
+	dualStack := flag.Bool("dual-stack", false, "probe one target over IPv4 and IPv6 side by side")
+	colorMode := flag.String("color", "auto", "colorize output: auto, always or never (auto honours NO_COLOR)")
+	method := flag.StringP("method", "X", "", "request method (default HEAD, or POST with --data)")
+	headers := flag.StringArrayP("header", "H", nil, "add a request header \"Name: value\" (repeatable)")
+	data := flag.String("data", "", "request body")
+	dataFile := flag.String("data-file", "", "read the request body from a file")
+	userAgent := flag.StringP("user-agent", "A", "", "User-Agent header")
+	expectStatus := flag.String("expect-status", "", "fail unless the status is in this list/range (e.g. 200-299,301)")
+	expectBody := flag.String("expect-body", "", "fail unless the response body matches this regex (implies GET)")
+	expectHeaders := flag.StringArray("expect-header", nil, "fail unless the response has this header \"Name: value\" (repeatable)")
+	maxLoss := flag.String("max-loss", "", "exit non-zero if loss exceeds this (e.g. 5%)")
+	maxP95 := flag.Duration("max-p95", 0, "exit non-zero if p95 latency exceeds this (e.g. 300ms)")
+	maxAvg := flag.Duration("max-avg", 0, "exit non-zero if average latency exceeds this (e.g. 150ms)")
+	listen := flag.String("listen", "", "serve Prometheus metrics on this address (e.g. :9101)")
+	headless := flag.Bool("headless", false, "no terminal output (requires --listen or --record)")
+	recordFile := flag.String("record", "", "record every probe to this file (view later with: hp replay FILE)")
+	reuse := flag.Bool("reuse", false, "keep one persistent connection per target (warm latency)")
+	reuseEvery := flag.Int("reuse-every", 0, "with --reuse, reconnect every N requests (implies --reuse)")
+	proxyFlag := flag.String("proxy", "", "proxy URL (overrides HTTPS_PROXY/HTTP_PROXY)")
+	profile := flag.StringP("profile", "P", "", "use a named profile from the config file")
+	configFile := flag.String("config", "", "config file (default $XDG_CONFIG_HOME/hp/hp.toml)")
 	showVersion := flag.BoolP("version", "v", false, "show version and exit")
-	flag.Parse()
+
+	// "hp replay FILE [flags]" re-renders a --record file instead of probing
+	cmdArgs := os.Args[1:]
+	replaying := len(cmdArgs) > 0 && cmdArgs[0] == "replay"
+	if replaying {
+		cmdArgs = cmdArgs[1:]
+	}
+	_ = flag.CommandLine.Parse(cmdArgs)
 
 	if *showVersion {
 		fmt.Printf("hp (hittyping) version %s\n", version)
 		os.Exit(0)
 	}
 
-	// Apply thresholds: env vars first, flags override
-	minLatency = getEnvInt("HP_MIN", minLatency)
-	greenThreshold = getEnvInt("HP_GREEN", greenThreshold)
-	yellowThreshold = getEnvInt("HP_YELLOW", yellowThreshold)
-	if *minFlag > 0 {
-		minLatency = *minFlag
-	}
-	if *greenFlag > 0 {
-		greenThreshold = *greenFlag
+	// Seed unset flags from the config file (and profile, if selected)
+	path := *configFile
+	if path == "" {
+		path = configPath()
 	}
-	if *yellowFlag > 0 {
-		yellowThreshold = *yellowFlag
-	}
-
-	// Extract host (without scheme) for building URLs dynamically
-	host := "1.1.1.1"
-	if flag.NArg() > 0 {
-		host = flag.Arg(0)
-		// Strip any existing scheme
-		host = strings.TrimPrefix(host, "https://")
-		host = strings.TrimPrefix(host, "http://")
-
-		// Check if it's an IPv6 address that needs brackets
-		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
-			// It's an IPv6 address, wrap in brackets
-			host = "[" + host + "]"
-		}
-	}
-
-	displayURL := host
-
-	// Resolve hostname to IP for display (and validate it exists).
-	// Skipped when a proxy is configured: the proxy resolves the host
-	// (e.g. socks5h), so the local resolver may legitimately fail.
-	resolvedIP := ""
-	// Strip brackets from IPv6 for parsing and display
-	hostForLookup := strings.TrimPrefix(strings.TrimSuffix(displayURL, "]"), "[")
-	if ip := net.ParseIP(hostForLookup); ip == nil && !proxyConfigured() {
-		ips, err := net.LookupHost(hostForLookup)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: cannot resolve %s: %v\n", hostForLookup, err)
-			os.Exit(1)
-		}
-		if len(ips) > 0 {
-			resolvedIP = ips[0]
-		}
-	}
-
-	s := &stats{min: time.Hour, braille: *useBraille}
-
-	// Disable terminal input processing to prevent keypresses from corrupting
-	// the display (echo, VDISCARD, VREPRINT, etc.).
-	restoreInput := disableInputProcessing()
-	fmt.Print(steadyCur)
-	cleanup := func() {
-		fmt.Print(defaultCur)
-		restoreInput()
+	cfg, err := loadConfig(path, *profile, *configFile != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
-	setup := func() {
-		restoreInput = disableInputProcessing()
-		fmt.Print(steadyCur)
+	profileTargets, err := applyConfig(flag.CommandLine, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Handle Ctrl-Z (suspend) and fg (resume)
-	redraw := func() {
-		fmt.Println() // reserve stats line
-		fmt.Print(up) // move back to bar line
-		redrawDisplay(s)
+	// Non-terminal stdout (pipe, file, cron) gets line-oriented output
+	tty := isTerminal(os.Stdout)
+	color, err := colorEnabled(*colorMode, tty, os.Getenv("NO_COLOR"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
-	handleSuspendResume(cleanup, setup, redraw)
+	setColor(color)
 
-	// Handle Ctrl+C
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
-	go func() {
-		<-sigCh
-		closePeriods(s)
-		if !*silent {
-			printFinal(displayURL, s)
-		}
-		cleanup()
-		os.Exit(0)
-	}()
+	// Apply thresholds: flags > env vars > config > defaults
+	minLatency = threshold(flag.CommandLine, "min", "HP_MIN", *minFlag, minLatency)
+	greenThreshold = threshold(flag.CommandLine, "green", "HP_GREEN", *greenFlag, greenThreshold)
+	yellowThreshold = threshold(flag.CommandLine, "yellow", "HP_YELLOW", *yellowFlag, yellowThreshold)
 
 	// Validate protocol flags (mutually exclusive)
 	protoCount := 0
@@ -259,13 +344,13 @@ func main() {
 	}
 
 	// Determine initial protocol level
-	currentProto := protoHTTPS
+	startProto := protoHTTPS
 	if *useHTTP1 {
-		currentProto = protoHTTP1
+		startProto = protoHTTP1
 	} else if *useHTTP2 {
-		currentProto = protoHTTP2
+		startProto = protoHTTP2
 	} else if *useHTTP3 {
-		currentProto = protoHTTP3
+		startProto = protoHTTP3
 	}
 
 	// Determine minimum protocol level for downgrade
@@ -273,171 +358,543 @@ func main() {
 	if *downgradeInsecure {
 		minProto = protoHTTP1
 	}
-	canDowngrade := *downgrade || *downgradeInsecure
 
-	// Print header
-	printHeader := func() {
-		// Move to beginning of line and clear
-		fmt.Print(col0 + clearLn)
-		if resolvedIP != "" {
-			fmt.Printf("%sHittyPing (v%s) %s%s%s [%s%s%s] (%s)%s\n", gray, version, reset+bold, displayURL, reset+gray, reset, resolvedIP, gray, protoNames[currentProto], reset)
-		} else {
-			fmt.Printf("%sHittyPing (v%s) %s%s %s(%s)%s\n", gray, version, reset+bold, displayURL, reset+gray, protoNames[currentProto], reset)
-		}
+	o := &options{
+		jitter:       *jitter,
+		timeout:      *timeout,
+		count:        *count,
+		warmup:       max(*warmup, 0),
+		maxInFlight:  max(*maxInFlight, 1),
+		insecure:     *insecure,
+		reuse:        *reuse || *reuseEvery > 0,
+		reuseEvery:   *reuseEvery,
+		braille:      *useBraille,
+		phaseBar:     *showPhases,
+		timeAxis:     *timeAxis,
+		markEvery:    *markEvery,
+		canDowngrade: *downgrade || *downgradeInsecure,
+		minProto:     minProto,
+		downAfter:    max(*downAfter, 1),
+		upgradeEvery: max(*upgradeEvery, 0),
+		upgradeH3:    *upgradeH3,
+		header:       !*noHeader && !*quiet && !*silent,
+		legend:       *showLegend && !*quiet && !*silent,
+		summary:      !*silent,
+		ctl:          newControls(*interval),
+		slo:          slo{maxP95: *maxP95, maxAvg: *maxAvg},
 	}
-	if !*noHeader && !*quiet && !*silent {
-		printHeader()
+	if o.req, err = newRequestSpec(*method, *headers, *data, *dataFile, *userAgent); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
-	if *showLegend && !*quiet && !*silent {
-		if *useBraille {
-			fmt.Printf("%sLegend: %s⡀⡄%s<%dms %s⡆%s<%dms %s⡇%s>=%dms %s%s!%sfail %s(2x density)%s\n",
-				gray, green, reset, greenThreshold, yellow, reset, yellowThreshold, red, reset, yellowThreshold, red, bold, reset, gray, reset)
-		} else {
-			fmt.Printf("%sLegend: %s▁▂▃%s<%dms %s▄▅%s<%dms %s▆▇█%s>=%dms %s%s!%sfail%s\n",
-				gray, green, reset, greenThreshold, yellow, reset, yellowThreshold, red, reset, yellowThreshold, red, bold, reset, reset)
+	if o.req.expect, err = newExpectations(*expectStatus, *expectBody, *expectHeaders); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// HEAD has no body to match
+	if *expectBody != "" && o.req.method == http.MethodHead && *method == "" {
+		o.req.method = http.MethodGet
+	}
+	if *maxLoss != "" {
+		o.slo.lossSet = true
+		if o.slo.maxLoss, err = parsePercent(*maxLoss); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --max-loss: %v\n", err)
+			os.Exit(1)
 		}
 	}
-	fmt.Println() // Reserve stats line
-	fmt.Print(up) // Move back to bar line
 
-	// Create HTTP client
-	url := getURLForProto(host, currentProto)
-	client := createClient(currentProto, *timeout, *insecure)
+	// Proxy: --proxy flag > HTTPS_PROXY/HTTP_PROXY env > config
+	if *proxyFlag != "" && (flag.CommandLine.Changed("proxy") || !proxyConfigured()) {
+		u, err := url.Parse(*proxyFlag)
+		if err != nil || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid proxy URL %q\n", *proxyFlag)
+			os.Exit(1)
+		}
+		o.proxy = u
+	}
+	if o.overrides, err = newDialOverrides(*resolve, *connectTo); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	o.tls, err = newTLSConfig(tlsSettings{
+		insecure: *insecure,
+		caFile:   *caCert,
+		certFile: *clientCert,
+		keyFile:  *clientKey,
+		min:      *tlsMin,
+		max:      *tlsMax,
+		sni:      *sni,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if o.certWarn, err = parseCertWarn(*certWarn); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Every way of probing over HTTP/3 needs TLS 1.3: -3, the comparison
+	// rows and --upgrade-h3 (including re-upgrades after a downgrade)
+	if (startProto == protoHTTP3 || *compare || o.upgradeH3) && o.tls.MaxVersion != 0 && o.tls.MaxVersion < tls.VersionTLS13 {
+		fmt.Fprintln(os.Stderr, "HTTP/3 requires TLS 1.3; --tls-max is too low for -3/--http3, --compare-protocols and --upgrade-h3")
+		os.Exit(1)
+	}
+	if *headless && *listen == "" && *recordFile == "" {
+		fmt.Fprintln(os.Stderr, "--headless needs --listen (or --record); otherwise nothing is shown or exported")
+		os.Exit(1)
+	}
+	// --duration / --until: stop at a wall-clock deadline
+	var deadline time.Time
+	if *duration < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --duration must not be negative")
+		os.Exit(1)
+	} else if *duration > 0 && *until != "" {
+		fmt.Fprintln(os.Stderr, "Cannot combine --duration and --until")
+		os.Exit(1)
+	} else if *duration > 0 {
+		deadline = time.Now().Add(*duration)
+	} else if *until != "" {
+		if deadline, err = parseUntil(*until, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *useIPv4 && *useIPv6 {
+		fmt.Fprintln(os.Stderr, "Cannot combine -4/--ipv4 and -6/--ipv6 (use --dual-stack)")
+		os.Exit(1)
+	} else if *useIPv4 {
+		o.family = 4
+	} else if *useIPv6 {
+		o.family = 6
+	}
 
-	consecutiveFailures := 0
-	requestNum := 0
-	for {
-		rtt, err := measureRTT(client, url, currentProto)
+	// Build one target per positional argument. A single unresolvable
+	// target is fatal; in multi-target mode it is reported and skipped.
+	// A replay takes its targets from the recording instead.
+	args := flag.Args()
+	if len(args) == 0 {
+		args = profileTargets
+	}
+	if len(args) == 0 {
+		args = []string{"1.1.1.1"}
+	}
+	var rc *recording
+	if replaying {
+		if len(flag.Args()) != 1 || *recordFile != "" {
+			fmt.Fprintln(os.Stderr, "Usage: hp replay FILE [display flags]")
+			os.Exit(1)
+		}
+		if !deadline.IsZero() {
+			fmt.Fprintln(os.Stderr, "--duration and --until only apply to live runs, not replay")
+			os.Exit(1)
+		}
+		if rc, err = openRecording(flag.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		o.reuse = rc.Reuse
+		args = nil
+	}
+	var targets []*target
+	if rc != nil {
+		targets = rc.targets(o)
+	}
+	if *compare {
+		if len(args) != 1 || protoCount > 0 || o.canDowngrade || o.upgradeH3 || rc != nil {
+			fmt.Fprintln(os.Stderr, "--compare-protocols takes a single target and no -1/-2/-3/-d/-D/--upgrade-h3")
+			os.Exit(1)
+		}
+		base, err := newTarget(args[0], protoHTTPS, o)
 		if err != nil {
-			s.failures++
-			consecutiveFailures++
-			recordPeriod(s, false)
-			if s.braille {
-				if s.hasPending {
-					// Pair with pending: pending=left, failure=right
-					s.blocks = append(s.blocks, getBrailleChar(s.pendingRTT, -1))
-					s.hasPending = false
-				} else {
-					// Store failure as pending
-					s.pendingRTT = -1
-					s.hasPending = true
-				}
-			} else {
-				s.blocks = append(s.blocks, red+bold+"!"+reset)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		targets = compareTargets(base, o)
+		args = nil
+	}
+	if *dualStack {
+		if len(args) != 1 || o.family != 0 || *compare || rc != nil {
+			fmt.Fprintln(os.Stderr, "--dual-stack takes a single target and no -4/-6/--compare-protocols")
+			os.Exit(1)
+		}
+		if targets, err = dualStackTargets(args[0], startProto, o); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		args = nil
+	}
+	for _, arg := range args {
+		t, err := newTarget(arg, startProto, o)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if len(args) == 1 {
+				os.Exit(1)
 			}
+			continue
+		}
+		t.idx = len(targets)
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no resolvable targets")
+		os.Exit(1)
+	}
+	// The time axis and separators are drawn only in the wrapping
+	// single-target bar; other views would silently drop them
+	if (o.timeAxis || o.markEvery > 0) && (len(targets) > 1 || !tty || *jsonOut || *headless) {
+		fmt.Fprintln(os.Stderr, "--time-axis and --mark-every need a single target on a terminal (no --json/--headless/--compare-protocols/--dual-stack)")
+		os.Exit(1)
+	}
 
-			// Check for downgrade (only at startup, before first successful ping)
-			if canDowngrade && consecutiveFailures >= 3 && currentProto > minProto && s.count == 0 {
-				// Find a working lower protocol by testing each one
-				candidateProto := currentProto
-				foundWorking := false
-				for candidateProto > minProto {
-					// Try next lower protocol
-					switch candidateProto {
-					case protoHTTP3:
-						candidateProto = protoHTTP2
-					case protoHTTP2:
-						candidateProto = protoHTTPS
-					case protoHTTPS:
-						candidateProto = protoHTTP1
-					}
-
-					// Test this protocol silently
-					testURL := getURLForProto(host, candidateProto)
-					testClient := createClient(candidateProto, *timeout, *insecure)
-					_, testErr := measureRTT(testClient, testURL, candidateProto)
-					if testErr == nil {
-						// Found working protocol
-						currentProto = candidateProto
-						url = testURL
-						client = testClient
-						foundWorking = true
-						break
-					}
-					// Otherwise continue to even lower protocol
-				}
+	var rec *recorder
+	if *recordFile != "" {
+		if rec, err = newRecorder(*recordFile, targets, o); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --record: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-				if foundWorking {
-					consecutiveFailures = 0
+	var mx *metrics
+	if *listen != "" {
+		mx = newMetrics(targets)
+		if err := serveMetrics(*listen, mx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --listen: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-					// Print downgrade message and update header
-					printDisplay(s)
-					if !*noHeader && !*quiet && !*silent {
-						fmt.Printf("\n%s↓ Downgrading to %s (3 initial failures)%s\n", yellow, protoNames[currentProto], reset)
-						printHeader()
-						fmt.Println() // Reserve stats line
-						fmt.Print(up) // Move back to bar line
-					}
+	var v view
+	if *headless {
+		v = headlessView{}
+	} else if *jsonOut {
+		v = newJSONView(targets, o.slo, os.Stdout)
+	} else if !tty {
+		v = &lineView{targets: targets, o: o, w: os.Stdout}
+	} else if len(targets) == 1 {
+		v = &singleView{t: targets[0], o: o}
+	} else {
+		title := ""
+		if *compare {
+			title = "protocol comparison"
+		} else if *dualStack {
+			title = "dual-stack"
+		}
+		v = &multiView{targets: targets, o: o, title: title}
+	}
 
-					// Skip to next iteration - don't double-print or wait
-					continue
-				}
+	// Disable terminal input processing to prevent keypresses from corrupting
+	// the display (echo, VDISCARD, VREPRINT, etc.).
+	// Cursor styling is skipped for JSON and non-terminal stdout so the
+	// output stays machine-readable.
+	curStart, curEnd := steadyCur, defaultCur
+	if *jsonOut || *headless || !tty {
+		curStart, curEnd = "", ""
+	}
+	restoreInput := disableInputProcessing()
+	fmt.Print(curStart)
+	cleanup := func() {
+		fmt.Print(curEnd)
+		restoreInput()
+	}
+	setup := func() {
+		restoreInput = disableInputProcessing()
+		fmt.Print(curStart)
+	}
+
+	// finish prints the final summary and exits, non-zero if an SLO
+	// limit was breached. Caller must hold displayMu.
+	finish := func() {
+		code := 0
+		for _, t := range targets {
+			closePeriods(t.s)
+			c, _ := o.slo.check(t.s)
+			code |= c
+		}
+		if o.summary {
+			v.final()
+		}
+		cleanup()
+		if rec != nil {
+			if err := rec.close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --record: %v\n", err)
 			}
+		}
+		os.Exit(code)
+	}
+
+	// Handle Ctrl-Z (suspend) and fg (resume)
+	handleSuspendResume(cleanup, setup, v.redraw)
+
+	// Handle Ctrl+C
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		<-sigCh
+		displayMu.Lock()
+		finish()
+	}()
+
+	displayMu.Lock()
+	v.start()
+	displayMu.Unlock()
+	if tty {
+		watchResize(v.resize)
+	}
+
+	// The deadline ends the run like q: summary, then the SLO exit code
+	if !deadline.IsZero() {
+		time.AfterFunc(time.Until(deadline), func() {
+			displayMu.Lock()
+			finish()
+		})
+	}
+
+	// Interactive keys (space, r, b, l, +/-, q) when attached to a terminal
+	if isTerminal(os.Stdin) && rc == nil {
+		keys := &keyHandler{targets: targets, v: v, ctl: o.ctl, quit: finish}
+		go keys.run(os.Stdin)
+	}
+
+	// One probe loop per target (or the recording, when replaying); this
+	// goroutine is the sole consumer of their results and owns all stats
+	// and terminal output.
+	results := make(chan result)
+	var replayErr error
+	if rc != nil {
+		go func() {
+			replayErr = rc.replay(targets, results)
+			close(results)
+		}()
+	} else {
+		var wg sync.WaitGroup
+		for _, t := range targets {
+			wg.Go(func() { runTarget(t, o, results) })
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+	}
+
+	for r := range results {
+		displayMu.Lock()
+		if rc != nil {
+			// Periods and the timeline keep the recorded times
+			done := r.at.Add(r.rtt)
+			clock = func() time.Time { return done }
+		}
+		if rec != nil {
+			rec.write(r)
+		}
+		if r.switched {
+			recordSwitch(r.t.s, r.at, r.from, r.proto)
+			r.t.proto = r.proto
 		} else {
-			s.count++
-			consecutiveFailures = 0 // Reset on success
-			recordPeriod(s, true)
-			s.total += rtt
-			s.last = rtt
-			if rtt < s.min {
-				s.min = rtt
+			if r.warmup {
+				recordWarmup(r.t.s, r.rtt, r.err)
+			} else {
+				recordResult(r.t.s, r.rtt, r.ph, r.err)
 			}
-			if rtt > s.max {
-				s.max = rtt
+			if r.tls != nil {
+				recordTLS(r.t.s, r.at, r.tls)
 			}
-			if s.braille {
-				if s.hasPending {
-					// Pair with pending: pending=left, current=right
-					s.blocks = append(s.blocks, getBrailleChar(s.pendingRTT, rtt))
-					s.hasPending = false
-				} else {
-					// Store as pending
-					s.pendingRTT = rtt
-					s.hasPending = true
-				}
+		}
+		v.update(r)
+		if mx != nil && !r.warmup {
+			mx.observe(r)
+		}
+		displayMu.Unlock()
+	}
+
+	displayMu.Lock()
+	if replayErr != nil {
+		fmt.Fprintf(os.Stderr, "\nError: replay: %v\n", replayErr)
+	}
+	finish()
+}
+
+// recordResult adds a single probe outcome to s: counters, min/max,
+// phase totals, UP/DOWN period tracking and the block (or braille half)
+// for the bar.
+func recordResult(s *stats, rtt time.Duration, ph phases, err error) {
+	if s.hasPending && s.pendingWarm {
+		// An odd warmup reading is not paired with a measured one
+		addBlock(s, warmupBlock(s.pendingRTT), s.pendingAt)
+		s.hasPending, s.pendingWarm = false, false
+	}
+	if err != nil {
+		// Assertion failures are DOWN like any failure, but counted and
+		// drawn separately
+		mark, glyph := rttFailed, red+bold+"!"+reset
+		if isAssertError(err) {
+			s.invalid++
+			mark, glyph = rttInvalid, invalidBlock
+		}
+		s.failures++
+		s.note = ""
+		recordPeriod(s, false, isAssertError(err))
+		if s.braille {
+			if s.hasPending {
+				// Pair with pending: pending=left, failure=right
+				addBlock(s, getBrailleChar(s.pendingRTT, mark), s.pendingAt)
+				s.hasPending = false
 			} else {
-				s.blocks = append(s.blocks, getBlock(rtt))
+				// Store failure as pending
+				s.pendingRTT = mark
+				s.pendingNew = false
+				s.pendingAt = clock()
+				s.hasPending = true
 			}
+		} else {
+			addBlock(s, glyph, clock())
 		}
-		printDisplay(s)
-		requestNum++
-		if *count > 0 && requestNum >= *count {
-			closePeriods(s)
-			if !*silent {
-				printFinal(displayURL, s)
+		return
+	}
+
+	s.count++
+	s.note = ""
+	recordPeriod(s, true, false)
+	s.total += rtt
+	s.last = rtt
+	s.hist.record(rtt)
+	s.lastPhases = ph
+	s.phaseTotal = s.phaseTotal.add(ph)
+	if rtt < s.min {
+		s.min = rtt
+	}
+	if rtt > s.max {
+		s.max = rtt
+	}
+	// With --reuse, samples that had to open a new connection are
+	// underlined so handshake cost stands out from warm requests
+	newConn := s.reuse && !ph.reused
+	if newConn {
+		s.newConns++
+		s.newTotal += rtt
+	}
+	if s.braille {
+		if s.hasPending {
+			// Pair with pending: pending=left, current=right
+			b := getBrailleChar(s.pendingRTT, rtt)
+			if newConn || s.pendingNew {
+				b = uline + b
 			}
-			cleanup()
-			os.Exit(0)
-		}
-		sleepDuration := *interval
-		if *jitter > 0 {
-			sleepDuration += time.Duration(rand.Int63n(int64(*jitter)))
+			addBlock(s, b, s.pendingAt)
+			s.hasPending = false
+		} else {
+			// Store as pending
+			s.pendingRTT = rtt
+			s.pendingNew = newConn
+			s.pendingAt = clock()
+			s.hasPending = true
 		}
-		time.Sleep(sleepDuration)
+	} else if newConn {
+		addBlock(s, uline+getBlock(rtt), clock())
+	} else {
+		addBlock(s, getBlock(rtt), clock())
+	}
+}
+
+// recordWarmup draws a --warmup probe, dimmed, leaving every counter,
+// percentile and UP/DOWN period alone. In braille mode warmup readings
+// only pair with each other.
+func recordWarmup(s *stats, rtt time.Duration, err error) {
+	if isAssertError(err) {
+		rtt = rttInvalid
+	} else if err != nil {
+		rtt = rttFailed
+	}
+	s.note = "warmup"
+	if !s.braille {
+		addBlock(s, warmupBlock(rtt), clock())
+	} else if s.hasPending {
+		addBlock(s, dim+getBrailleChar(s.pendingRTT, rtt), s.pendingAt)
+		s.hasPending, s.pendingWarm = false, false
+	} else {
+		s.pendingRTT = rtt
+		s.pendingNew = false
+		s.pendingWarm = true
+		s.pendingAt = clock()
+		s.hasPending = true
+	}
+}
+
+// warmupBlock is the dimmed block for a warmup reading (or rttFailed,
+// rttInvalid).
+func warmupBlock(rtt time.Duration) string {
+	switch rtt {
+	case rttInvalid:
+		return dim + magenta + "×" + reset
+	case rttFailed:
+		return dim + red + "!" + reset
 	}
+	return dim + getBlock(rtt)
 }
 
-func measureRTT(client *http.Client, url string, protoLevel int) (time.Duration, error) {
-	req, err := http.NewRequest("HEAD", url, nil)
+// newStats returns empty stats with the display settings from o.
+func newStats(o *options) *stats {
+	return &stats{min: time.Hour, braille: o.braille, phaseBar: o.phaseBar, reuse: o.reuse, timeAxis: o.timeAxis, markEvery: o.markEvery, certWarn: o.certWarn}
+}
+
+// addBlock appends a bar cell for a probe (or braille pair) that
+// completed at t.
+func addBlock(s *stats, b string, t time.Time) {
+	s.blocks = append(s.blocks, b)
+	s.blockTimes = append(s.blockTimes, t)
+}
+
+// measurement is what a single request revealed about the target.
+type measurement struct {
+	rtt    time.Duration
+	ph     phases
+	status int      // HTTP status code (0 if no response)
+	altSvc string   // Alt-Svc response header (HTTPS and up)
+	tls    *tlsInfo // handshake details (nil for plain HTTP)
+	remote string   // IP of the connection that carried the request ("" = unknown)
+}
+
+// measureRTT sends one request (HEAD if spec is nil) and returns its total
+// duration together with the per-phase breakdown collected via httptrace.
+func measureRTT(client *http.Client, url string, protoLevel int, spec *requestSpec) (measurement, error) {
+	var m measurement
+	req, err := spec.newRequest(url)
 	if err != nil {
-		return 0, err
+		return m, err
 	}
+	pt := &phaseTracer{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), pt.trace()))
 
 	start := time.Now()
 	resp, err := client.Do(req)
 	elapsed := time.Since(start)
 
 	if err != nil {
-		return 0, err
+		return m, err
+	}
+	defer func() {
+		// Drain (bounded) so a keep-alive connection can be reused
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+		_ = resp.Body.Close()
+	}()
+	m.status = resp.StatusCode
+	m.tls = newTLSInfo(resp.TLS)
+	m.remote = pt.remoteIP()
+	if protoLevel != protoHTTP1 {
+		m.altSvc = resp.Header.Get("Alt-Svc")
 	}
-	_ = resp.Body.Close()
 
 	// Check HTTP/2 requirement
 	if protoLevel == protoHTTP2 && resp.Proto != "HTTP/2.0" {
-		return 0, fmt.Errorf("HTTP/2 not negotiated (got %s)", resp.Proto)
+		return m, fmt.Errorf("HTTP/2 not negotiated (got %s)", resp.Proto)
 	}
 
-	return elapsed, nil
+	m.rtt = elapsed
+	m.ph = pt.phases()
+	if spec != nil && spec.expect != nil {
+		// Timing is kept: an assertion failure still got a response
+		return m, spec.expect.check(resp)
+	}
+	return m, nil
 }
 
 // proxyConfigured reports whether any HTTP/HTTPS proxy env var is set.
@@ -451,23 +908,30 @@ func proxyConfigured() bool {
 	return false
 }
 
-func createClient(protoLevel int, timeout time.Duration, insecure bool) *http.Client {
+func createClient(protoLevel int, o *options) *http.Client {
 	if protoLevel == protoHTTP3 {
-		return newHTTP3Client(timeout, insecure)
+		return newHTTP3Client(o)
 	}
 
 	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: insecure,
-		},
-		DisableKeepAlives: true,
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   o.tlsConfig(),
+		DisableKeepAlives: !o.reuse,
+	}
+	if o.proxy != nil {
+		transport.Proxy = http.ProxyURL(o.proxy)
+	}
+	if o.overrides != nil || o.family != 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, familyNetwork(network, o.family), o.overrides.addr(addr))
+		}
 	}
 	if protoLevel == protoHTTP2 {
 		transport.ForceAttemptHTTP2 = true
 	}
 	return &http.Client{
-		Timeout:   timeout,
+		Timeout:   o.timeout,
 		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
@@ -530,6 +994,9 @@ func getBrailleChar(leftRTT, rightRTT time.Duration) string {
 
 	// Handle failures
 	if leftHeight < 0 && rightHeight < 0 {
+		if leftRTT == rttInvalid && rightRTT == rttInvalid {
+			return invalidBlock
+		}
 		return red + bold + "!" + reset
 	}
 	if leftHeight < 0 {
@@ -642,83 +1109,195 @@ func truncateToWidth(s string, w int) string {
 	return b.String()
 }
 
-func printDisplay(s *stats) {
-	displayMu.Lock()
-	defer displayMu.Unlock()
+// Glyph drawn in the bar every --mark-every
+const markGlyph = "┊"
 
+// printDisplay prints blocks added since the last call and refreshes the
+// stats line. With --time-axis each bar line starts with the time of its
+// first block; with --mark-every a separator precedes the first block
+// past each boundary. Caller must hold displayMu.
+func printDisplay(s *stats) {
 	width := getTermWidth()
+	wrap := func() {
+		// Move to stats line, print newline to scroll, move back up, clear line
+		fmt.Print(down + "\n" + up + col0 + clearLn)
+		s.col = 0
+	}
 
 	// Print new blocks since last print (incremental)
 	for s.lastPrinted < len(s.blocks) {
-		fmt.Print(s.blocks[s.lastPrinted])
+		i := s.lastPrinted
+		if s.col == 0 {
+			s.lineStart = i
+			n := 0
+			if s.timeAxis {
+				var prefix string
+				prefix, n = linePrefix(s.blockTimes[i], width)
+				fmt.Print(prefix)
+				s.col += n
+			}
+			// A boundary between two lines starts the new one, unless
+			// its time label already marks it
+			if n == 0 && i > 0 && s.markEvery > 0 && crossesMark(s.blockTimes[i-1], s.blockTimes[i], s.markEvery) {
+				fmt.Print(gray + markGlyph + reset)
+				s.col++
+			}
+		} else if s.markEvery > 0 && crossesMark(s.blockTimes[i-1], s.blockTimes[i], s.markEvery) {
+			if s.col+2 >= width {
+				// No room for separator and block; both go on the next line
+				wrap()
+				continue
+			}
+			fmt.Print(gray + markGlyph + reset)
+			s.col++
+		}
+		fmt.Print(s.blocks[i])
 		s.col++
 		s.lastPrinted++
 
 		// Check if we need to wrap to next line for the NEXT block
 		if s.col >= width-1 {
-			// Move to stats line, print newline to scroll, move back up, clear line
-			fmt.Print(down + "\n" + up + col0 + clearLn)
-			s.col = 0
+			wrap()
 		}
 	}
 
 	printStats(s, width)
 }
 
-// redrawDisplay reprints the visible bar tail and stats from scratch.
-// Caller must hold displayMu.
-func redrawDisplay(s *stats) {
-	width := getTermWidth()
-
-	// Only redraw blocks that were on the current line before suspend.
-	// s.col tracks how far along the current line we were.
-	count := s.col
-	if count > width-1 {
-		count = width - 1
-	}
-	start := len(s.blocks) - count
-	if start < 0 {
-		start = 0
+// linePrefix returns the --time-axis label for a bar line whose first
+// block completed at t, and its width in columns. The label is dropped
+// on terminals too narrow to leave the bar most of the line.
+func linePrefix(t time.Time, width int) (string, int) {
+	label := t.Format("15:04:05") + " "
+	if width < 3*len(label) {
+		return "", 0
 	}
+	return gray + label + reset, len(label)
+}
+
+// crossesMark reports whether a multiple of every (on the wall clock)
+// falls after prev and at or before cur.
+func crossesMark(prev, cur time.Time, every time.Duration) bool {
+	_, offset := cur.Zone()
+	shift := time.Duration(offset) * time.Second
+	return !prev.Add(shift).Truncate(every).Equal(cur.Add(shift).Truncate(every))
+}
+
+// redrawDisplay reprints the current bar line from its first block, any
+// blocks added since, and the stats. The cursor must be at the start of
+// the bar line. Caller must hold displayMu.
+func redrawDisplay(s *stats) {
+	s.lastPrinted = s.lineStart
 	s.col = 0
-	for i := start; i < len(s.blocks); i++ {
-		fmt.Print(s.blocks[i])
-		s.col++
+	printDisplay(s)
+}
+
+// reflowDisplay repaints the current bar line and stats after the
+// terminal width changed. Terminals that reflow (tmux, iTerm2, VTE) may
+// have wrapped the current line onto extra rows, so the cursor first
+// climbs back to where the line started; its blocks are then reprinted
+// by redrawDisplay, wrapping at the new width. Caller must hold
+// displayMu.
+func reflowDisplay(s *stats) {
+	width := getTermWidth()
+	if rows := wrappedRows(s.col, width); rows > 0 {
+		fmt.Printf("\033[%dA", rows)
 	}
-	s.lastPrinted = len(s.blocks)
+	fmt.Print(col0 + clearDn)
+	redrawDisplay(s)
+}
 
-	printStats(s, width)
+// wrappedRows returns how many rows the cursor sits below the start of a
+// line of col cells once a reflowing terminal re-wraps it at width. A
+// line that exactly fills its last row leaves the cursor on that row.
+func wrappedRows(col, width int) int {
+	if width <= 0 || col <= width {
+		return 0
+	}
+	return (col - 1) / width
 }
 
 // printStats prints the stats line below the bar and returns the cursor
 // to its position on the bar line. Uses relative cursor movement instead
 // of save/restore to avoid position corruption from terminal scrolling.
 func printStats(s *stats, width int) {
+	statsText := truncateToWidth(formatStats(s), width)
+
+	// The optional legend occupies one more line below the stats line;
+	// when it is switched off that line is cleared once.
+	legend := ""
+	if s.legend {
+		legend = "\n" + col0 + clearLn + truncateToWidth(legendText(s.braille), width) + up
+		s.legendShown = true
+	} else if s.legendShown {
+		legend = "\n" + col0 + clearLn + up
+		s.legendShown = false
+	}
+
+	// \n moves to stats line (scrolls if at bottom), print stats, then
+	// use relative up + column positioning to return to bar line.
+	fmt.Printf("\n%s%s%s%s%s\033[%dG", col0, clearLn, statsText, legend, up, s.col+1)
+}
+
+// summarize returns the loss percentage and min/avg/max RTT in ms for s.
+// min is reported as 0 until the first successful request.
+func summarize(s *stats) (lossPct int, minMs, avgMs, maxMs int64) {
 	total := s.count + s.failures
-	var lossPct int
 	if total > 0 {
 		lossPct = s.failures * 100 / total
 	}
-	var avg time.Duration
 	if s.count > 0 {
-		avg = s.total / time.Duration(s.count)
+		avgMs = (s.total / time.Duration(s.count)).Milliseconds()
 	}
-	minMs := s.min.Milliseconds()
+	minMs = s.min.Milliseconds()
 	if s.min == time.Hour {
 		minMs = 0
 	}
+	return lossPct, minMs, avgMs, s.max.Milliseconds()
+}
 
-	statsText := fmt.Sprintf("%d/%s%d%s %s(%2d%%) lost;%s %d/%s%d%s/%d%sms; last:%s %s%d%s%sms%s",
+// connAverages returns the mean RTT of successful samples that opened a
+// new connection and of those that reused one (0 when there were none).
+func connAverages(s *stats) (newAvg, reusedAvg time.Duration) {
+	if s.newConns > 0 {
+		newAvg = s.newTotal / time.Duration(s.newConns)
+	}
+	if reused := s.count - s.newConns; reused > 0 {
+		reusedAvg = (s.total - s.newTotal) / time.Duration(reused)
+	}
+	return newAvg, reusedAvg
+}
+
+// formatStats returns the colored one-line stats summary shown below the bar.
+func formatStats(s *stats) string {
+	total := s.count + s.failures
+	lossPct, minMs, avgMs, maxMs := summarize(s)
+	text := fmt.Sprintf("%d/%s%d%s %s(%2d%%) lost;%s %d/%s%d%s/%d%sms; last:%s %s%d%s%sms%s",
 		s.failures, bold, total, reset,
 		gray, lossPct, reset,
-		minMs, bold, avg.Milliseconds(), reset, s.max.Milliseconds(), gray, reset,
+		minMs, bold, avgMs, reset, maxMs, gray, reset,
 		bold, s.last.Milliseconds(), reset, gray, reset)
-
-	statsText = truncateToWidth(statsText, width)
-
-	// \n moves to stats line (scrolls if at bottom), print stats, then
-	// use relative up + column positioning to return to bar line.
-	fmt.Printf("\n%s%s%s%s\033[%dG", col0, clearLn, statsText, up, s.col+1)
+	if s.invalid > 0 {
+		text += fmt.Sprintf(" %s[%d invalid]%s", magenta, s.invalid, reset)
+	}
+	if s.reuse && s.count > 0 {
+		newAvg, reusedAvg := connAverages(s)
+		text += fmt.Sprintf(" %snew/reused%s %d/%d%sms%s", gray, reset, newAvg.Milliseconds(), reusedAvg.Milliseconds(), gray, reset)
+	}
+	if s.paused {
+		text += fmt.Sprintf(" %s[paused]%s", yellow, reset)
+	}
+	if s.note != "" {
+		text += fmt.Sprintf(" %s[%s]%s", yellow, s.note, reset)
+	}
+	text += certWarnings(s, clock())
+	if s.count == 0 {
+		return text
+	}
+	if s.phaseBar && colorOn {
+		return text + " " + phaseBar(s.lastPhases, 20)
+	}
+	return text + fmt.Sprintf(" %s[%s]%s", gray, formatPhases(s.lastPhases), reset)
 }
 
 func fmtDuration(d time.Duration) string {
@@ -735,30 +1314,44 @@ func fmtDuration(d time.Duration) string {
 	return fmt.Sprintf("%ds", sec)
 }
 
-func printFinal(url string, s *stats) {
+func printFinal(url string, s *stats, lim slo) {
 	total := s.count + s.failures
-	var lossPct int
-	if total > 0 {
-		lossPct = s.failures * 100 / total
-	}
+	lossPct, minMs, avgMs, maxMs := summarize(s)
 
-	var avg time.Duration
+	fmt.Printf("\n\n%s--- %s hp statistics ---%s\n", gray, url, reset)
+	invalid := ""
+	if s.invalid > 0 {
+		invalid = fmt.Sprintf(" (%s%d invalid%s)", magenta, s.invalid, reset)
+	}
+	fmt.Printf("%d requests, %d ok, %d failed%s, %d%% loss\n", total, s.count, s.failures, invalid, lossPct)
 	if s.count > 0 {
-		avg = s.total / time.Duration(s.count)
+		fmt.Printf("round-trip min/avg/max = %d/%d/%d ms\n", minMs, avgMs, maxMs)
+		fmt.Println(percentileLine(s))
+		if s.reuse {
+			newAvg, reusedAvg := connAverages(s)
+			fmt.Printf("connections: %d new (avg %d ms), %d reused (avg %d ms)\n",
+				s.newConns, newAvg.Milliseconds(), s.count-s.newConns, reusedAvg.Milliseconds())
+		}
+		avgPhases := s.phaseTotal.div(s.count)
+		fmt.Printf("phases avg: %s\n", formatPhases(avgPhases))
+		if s.phaseBar && colorOn {
+			fmt.Printf("%s  %s\n", phaseBar(avgPhases, 40), phaseLegend())
+		}
+		if s.count > 1 {
+			fmt.Printf("%shistogram:%s\n", gray, reset)
+			for _, line := range histogramLines(&s.hist, s.min, s.max, 8, 30) {
+				fmt.Println(line)
+			}
+		}
 	}
-
-	minMs := s.min.Milliseconds()
-	if s.min == time.Hour {
-		minMs = 0
+	for _, line := range certSummary(s, clock()) {
+		fmt.Println(line)
 	}
-
-	fmt.Printf("\n\n%s--- %s hp statistics ---%s\n", gray, url, reset)
-	fmt.Printf("%d requests, %d ok, %d failed, %d%% loss\n", total, s.count, s.failures, lossPct)
-	if s.count > 0 {
-		fmt.Printf("round-trip min/avg/max = %d/%d/%d ms\n", minMs, avg.Milliseconds(), s.max.Milliseconds())
+	if _, reasons := lim.check(s); len(reasons) > 0 {
+		fmt.Println(sloLine(reasons))
 	}
 
-	if s.failures > 0 && len(s.periods) > 0 {
+	if (s.failures > 0 || len(s.switches) > 0) && len(s.periods) > 0 {
 		fmt.Printf("%stimeline:%s\n", gray, reset)
 		periods := s.periods
 		truncated := 0
@@ -768,7 +1361,8 @@ func printFinal(url string, s *stats) {
 			tail := periods[len(periods)-5:]
 			periods = append(head, tail...)
 		}
-		now := time.Now()
+		switches := s.switches
+		now := clock()
 		// include date if session spans multiple calendar days
 		tsFmt := "15:04:05"
 		if len(s.periods) > 0 {
@@ -789,6 +1383,10 @@ func printFinal(url string, s *stats) {
 				label = "DOWN"
 				color = red
 				detail = fmt.Sprintf("(%d lost)", p.count)
+				if p.invalid > 0 {
+					// Lost to --expect-* checks vs the network
+					detail = fmt.Sprintf("(%d lost: %d invalid, %d failed)", p.count, p.invalid, p.count-p.invalid)
+				}
 			}
 			isLast := i == len(periods)-1 && truncated == 0 ||
 				i == len(periods)-1 && truncated > 0
@@ -806,6 +1404,17 @@ func printFinal(url string, s *stats) {
 				fmt.Printf("  %s  %s%s%s  %6s %s\n", ts, color, label, reset, dur, detail)
 			}
 
+			// Protocol switches before the next listed period
+			for len(switches) > 0 && (i+1 == len(periods) || switches[0].at.Before(periods[i+1].start)) {
+				sw := switches[0]
+				switches = switches[1:]
+				arrow, color := "↓", yellow
+				if sw.to > sw.from {
+					arrow, color = "↑", green
+				}
+				fmt.Printf("  %s  %s%s %s%s\n", sw.at.Format(tsFmt), color, arrow, protoNames[sw.to], reset)
+			}
+
 			if truncated > 0 && i == 4 {
 				fmt.Printf("  %s... %d more ...%s\n", gray, truncated, reset)
 			}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -624,7 +626,7 @@ func TestFmtDuration_TableDriven(t *testing.T) {
 func TestRecordPeriod(t *testing.T) {
 	t.Run("first-success-creates-up", func(t *testing.T) {
 		s := &stats{}
-		recordPeriod(s, true)
+		recordPeriod(s, true, false)
 		if s.currentPeriod == nil {
 			t.Fatal("currentPeriod is nil")
 		}
@@ -641,7 +643,7 @@ func TestRecordPeriod(t *testing.T) {
 
 	t.Run("first-failure-creates-down", func(t *testing.T) {
 		s := &stats{}
-		recordPeriod(s, false)
+		recordPeriod(s, false, false)
 		if s.currentPeriod == nil {
 			t.Fatal("currentPeriod is nil")
 		}
@@ -655,9 +657,9 @@ func TestRecordPeriod(t *testing.T) {
 
 	t.Run("consecutive-same-increments", func(t *testing.T) {
 		s := &stats{}
-		recordPeriod(s, true)
-		recordPeriod(s, true)
-		recordPeriod(s, true)
+		recordPeriod(s, true, false)
+		recordPeriod(s, true, false)
+		recordPeriod(s, true, false)
 		if s.currentPeriod.count != 3 {
 			t.Errorf("count = %d; want 3", s.currentPeriod.count)
 		}
@@ -668,9 +670,9 @@ func TestRecordPeriod(t *testing.T) {
 
 	t.Run("transition-closes-period", func(t *testing.T) {
 		s := &stats{}
-		recordPeriod(s, true)
-		recordPeriod(s, true)
-		recordPeriod(s, false) // transition
+		recordPeriod(s, true, false)
+		recordPeriod(s, true, false)
+		recordPeriod(s, false, false) // transition
 		if len(s.periods) != 1 {
 			t.Fatalf("periods = %d; want 1", len(s.periods))
 		}
@@ -690,12 +692,12 @@ func TestRecordPeriod(t *testing.T) {
 
 	t.Run("multiple-transitions", func(t *testing.T) {
 		s := &stats{}
-		recordPeriod(s, true)  // UP
-		recordPeriod(s, true)  // UP (2)
-		recordPeriod(s, false) // DOWN
-		recordPeriod(s, false) // DOWN (2)
-		recordPeriod(s, false) // DOWN (3)
-		recordPeriod(s, true)  // UP again
+		recordPeriod(s, true, false)  // UP
+		recordPeriod(s, true, false)  // UP (2)
+		recordPeriod(s, false, false) // DOWN
+		recordPeriod(s, false, false) // DOWN (2)
+		recordPeriod(s, false, false) // DOWN (3)
+		recordPeriod(s, true, false)  // UP again
 		if len(s.periods) != 2 {
 			t.Fatalf("periods = %d; want 2", len(s.periods))
 		}
@@ -710,10 +712,20 @@ func TestRecordPeriod(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid-counted-separately", func(t *testing.T) {
+		s := &stats{}
+		recordResult(s, 0, phases{}, errors.New("timeout"))
+		recordResult(s, 5*time.Millisecond, phases{}, &assertError{"unexpected status 503"})
+		recordResult(s, 5*time.Millisecond, phases{}, &assertError{"unexpected status 503"})
+		if p := s.currentPeriod; p.up || p.count != 3 || p.invalid != 2 {
+			t.Errorf("current: up=%v count=%d invalid=%d; want one DOWN period of 3 with 2 invalid", p.up, p.count, p.invalid)
+		}
+	})
+
 	t.Run("close-periods", func(t *testing.T) {
 		s := &stats{}
-		recordPeriod(s, true)
-		recordPeriod(s, false)
+		recordPeriod(s, true, false)
+		recordPeriod(s, false, false)
 		closePeriods(s)
 		if len(s.periods) != 2 {
 			t.Fatalf("periods = %d; want 2", len(s.periods))
@@ -770,3 +782,279 @@ func TestGetEnvInt_TableDriven(t *testing.T) {
 		})
 	}
 }
+
+// =============================================================================
+// Test: recordResult and summarize function tests
+// =============================================================================
+
+func TestRecordResult(t *testing.T) {
+	withThresholds(0, 150, 400, func() {
+		s := &stats{min: time.Hour}
+		recordResult(s, 20*time.Millisecond, phases{ttfb: 20 * time.Millisecond}, nil)
+		recordResult(s, 0, phases{}, errors.New("timeout"))
+		recordResult(s, 40*time.Millisecond, phases{connect: 10 * time.Millisecond, ttfb: 30 * time.Millisecond}, nil)
+
+		if s.count != 2 || s.failures != 1 {
+			t.Errorf("count/failures = %d/%d; want 2/1", s.count, s.failures)
+		}
+		if s.min != 20*time.Millisecond || s.max != 40*time.Millisecond {
+			t.Errorf("min/max = %v/%v; want 20ms/40ms", s.min, s.max)
+		}
+		if s.last != 40*time.Millisecond {
+			t.Errorf("last = %v; want 40ms", s.last)
+		}
+		if s.phaseTotal.ttfb != 50*time.Millisecond || s.lastPhases.connect != 10*time.Millisecond {
+			t.Errorf("phaseTotal.ttfb = %v, lastPhases.connect = %v; want 50ms, 10ms", s.phaseTotal.ttfb, s.lastPhases.connect)
+		}
+		if len(s.blocks) != 3 {
+			t.Fatalf("blocks = %d; want 3", len(s.blocks))
+		}
+		if s.blocks[1] != red+bold+"!"+reset {
+			t.Errorf("failure block = %q; want red !", s.blocks[1])
+		}
+		if len(s.periods) != 2 || !s.currentPeriod.up {
+			t.Errorf("periods = %d, current up = %v; want 2, true", len(s.periods), s.currentPeriod.up)
+		}
+	})
+}
+
+func TestRecordResult_BraillePairsReadings(t *testing.T) {
+	s := &stats{min: time.Hour, braille: true}
+	recordResult(s, 10*time.Millisecond, phases{}, nil)
+	if len(s.blocks) != 0 || !s.hasPending {
+		t.Fatalf("after 1 reading: blocks = %d, pending = %v; want 0, true", len(s.blocks), s.hasPending)
+	}
+	recordResult(s, 0, phases{}, errors.New("timeout"))
+	if len(s.blocks) != 1 || s.hasPending {
+		t.Errorf("after 2 readings: blocks = %d, pending = %v; want 1, false", len(s.blocks), s.hasPending)
+	}
+}
+
+func TestRecordResult_MarksNewConnectionsWithReuse(t *testing.T) {
+	s := &stats{min: time.Hour, reuse: true}
+	recordResult(s, 40*time.Millisecond, phases{}, nil)
+	recordResult(s, 10*time.Millisecond, phases{reused: true}, nil)
+	recordResult(s, 20*time.Millisecond, phases{reused: true}, nil)
+
+	if !strings.HasPrefix(s.blocks[0], uline) || strings.HasPrefix(s.blocks[1], uline) {
+		t.Errorf("blocks = %q; want only the new-connection sample underlined", s.blocks)
+	}
+	newAvg, reusedAvg := connAverages(s)
+	if s.newConns != 1 || newAvg != 40*time.Millisecond || reusedAvg != 15*time.Millisecond {
+		t.Errorf("newConns = %d, averages = %v/%v; want 1, 40ms/15ms", s.newConns, newAvg, reusedAvg)
+	}
+	if !strings.Contains(formatStats(s), "40/15") {
+		t.Errorf("formatStats = %q; want new/reused 40/15ms", formatStats(s))
+	}
+
+	// Without --reuse every sample is a new connection: nothing is marked
+	plain := &stats{min: time.Hour}
+	recordResult(plain, 40*time.Millisecond, phases{}, nil)
+	if strings.HasPrefix(plain.blocks[0], uline) || plain.newConns != 0 {
+		t.Errorf("plain mode marked a new connection: %q", plain.blocks[0])
+	}
+}
+
+func TestRecordWarmup_DrawnButNotCounted(t *testing.T) {
+	s := &stats{min: time.Hour}
+	recordWarmup(s, 300*time.Millisecond, nil)
+	recordWarmup(s, 0, errors.New("timeout"))
+	recordResult(s, 20*time.Millisecond, phases{}, nil)
+
+	if len(s.blocks) != 3 || !strings.HasPrefix(s.blocks[0], dim) || !strings.HasPrefix(s.blocks[1], dim) || strings.HasPrefix(s.blocks[2], dim) {
+		t.Fatalf("blocks = %q; want two dimmed warmup blocks, then a normal one", s.blocks)
+	}
+	if s.count != 1 || s.failures != 0 || s.max != 20*time.Millisecond || s.hist.n != 1 {
+		t.Errorf("count/failures/max = %d/%d/%v; want only the measured probe", s.count, s.failures, s.max)
+	}
+	if len(s.periods) != 0 || s.currentPeriod == nil || s.currentPeriod.count != 1 {
+		t.Errorf("periods = %v, current = %+v; want a single UP period of 1", s.periods, s.currentPeriod)
+	}
+
+	// In braille mode warmup readings pair with each other, and an odd
+	// one out is drawn on its own before the first measured reading
+	b := &stats{min: time.Hour, braille: true}
+	for range 3 {
+		recordWarmup(b, 10*time.Millisecond, nil)
+	}
+	recordResult(b, 10*time.Millisecond, phases{}, nil)
+	if len(b.blocks) != 2 || !strings.HasPrefix(b.blocks[1], dim) || !b.hasPending || b.pendingWarm {
+		t.Errorf("braille blocks = %q, pending = %v/%v; want 2 warmup cells and the measured reading pending", b.blocks, b.hasPending, b.pendingWarm)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        stats
+		wantLoss int
+		wantMin  int64
+		wantAvg  int64
+		wantMax  int64
+	}{
+		{"empty", stats{min: time.Hour}, 0, 0, 0, 0},
+		{"all-failed", stats{min: time.Hour, failures: 4}, 100, 0, 0, 0},
+		{"mixed", stats{count: 3, failures: 1, total: 60 * time.Millisecond, min: 10 * time.Millisecond, max: 30 * time.Millisecond}, 25, 10, 20, 30},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loss, minMs, avgMs, maxMs := summarize(&tc.s)
+			if loss != tc.wantLoss || minMs != tc.wantMin || avgMs != tc.wantAvg || maxMs != tc.wantMax {
+				t.Errorf("summarize() = %d/%d/%d/%d; want %d/%d/%d/%d",
+					loss, minMs, avgMs, maxMs, tc.wantLoss, tc.wantMin, tc.wantAvg, tc.wantMax)
+			}
+		})
+	}
+}
+
+// =============================================================================
+// Test: reflow on terminal resize
+// =============================================================================
+
+func TestWrappedRows_TableDriven(t *testing.T) {
+	tests := []struct {
+		name       string
+		col, width int
+		want       int
+	}{
+		{"fits", 40, 80, 0},
+		{"exactly-full", 80, 80, 0},
+		{"one-over", 81, 80, 1},
+		{"two-rows-full", 160, 80, 1},
+		{"three-rows", 161, 80, 2},
+		{"zero-width", 100, 0, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := wrappedRows(tc.col, tc.width); got != tc.want {
+				t.Errorf("wrappedRows(%d, %d) = %d; want %d", tc.col, tc.width, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReflowDisplay_RewrapsCurrentLine(t *testing.T) {
+	// Simulate a shrink: 100 blocks on the current line, 10 from an
+	// earlier line. The test terminal is 80 wide, so the line wraps
+	// after 79 blocks and 21 remain on the new current line.
+	s := &stats{min: time.Hour}
+	for range 110 {
+		recordResult(s, 10*time.Millisecond, phases{}, nil)
+	}
+	s.lastPrinted = 110
+	s.lineStart = 10
+	s.col = 100
+
+	reflowDisplay(s)
+
+	if s.lastPrinted != 110 || s.col != 21 {
+		t.Errorf("lastPrinted/col = %d/%d; want 110/21", s.lastPrinted, s.col)
+	}
+}
+
+// =============================================================================
+// Test: time axis and bar marks
+// =============================================================================
+
+func TestCrossesMark_TableDriven(t *testing.T) {
+	at := func(hms string) time.Time {
+		tm, _ := time.ParseInLocation("15:04:05", hms, time.Local)
+		return tm
+	}
+	tests := []struct {
+		name      string
+		prev, cur string
+		every     time.Duration
+		want      bool
+	}{
+		{"same-minute", "12:00:10", "12:00:50", time.Minute, false},
+		{"onto-boundary", "12:00:55", "12:01:00", time.Minute, true},
+		{"past-boundary", "12:00:58", "12:01:03", time.Minute, true},
+		{"five-minutes-no", "12:01:00", "12:04:59", 5 * time.Minute, false},
+		{"five-minutes-yes", "12:04:59", "12:05:01", 5 * time.Minute, true},
+		{"gap-spans-several", "12:00:00", "12:30:00", 5 * time.Minute, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := crossesMark(at(tc.prev), at(tc.cur), tc.every); got != tc.want {
+				t.Errorf("crossesMark(%s, %s, %v) = %v; want %v", tc.prev, tc.cur, tc.every, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLinePrefix(t *testing.T) {
+	tm := time.Date(2026, 5, 17, 9, 5, 7, 0, time.Local)
+	if p, n := linePrefix(tm, 80); !strings.Contains(p, "09:05:07 ") || n != 9 {
+		t.Errorf("linePrefix = %q, %d; want 09:05:07 label of width 9", p, n)
+	}
+	if p, n := linePrefix(tm, 20); p != "" || n != 0 {
+		t.Errorf("narrow linePrefix = %q, %d; want none", p, n)
+	}
+}
+
+func TestPrintDisplay_MarkAtLineStart(t *testing.T) {
+	// Test terminal is 80 wide: 79 blocks fill the first line and the
+	// 80th crosses 12:00:00, so the separator starts the second line
+	s := &stats{min: time.Hour, markEvery: time.Minute}
+	start := time.Date(2026, 5, 17, 11, 59, 0, 0, time.Local)
+	for i := range 79 {
+		addBlock(s, "x", start.Add(time.Duration(i)*500*time.Millisecond))
+	}
+	addBlock(s, "x", start.Add(70*time.Second))
+	printDisplay(s)
+	if s.lineStart != 79 || s.col != 2 {
+		t.Errorf("lineStart/col = %d/%d; want 79/2 (separator, then the block)", s.lineStart, s.col)
+	}
+	redrawDisplay(s)
+	if s.col != 2 {
+		t.Errorf("after redraw col = %d; want 2", s.col)
+	}
+}
+
+func TestPrintDisplay_TimeAxisAndMarks(t *testing.T) {
+	// Test terminal is 80 wide: 9-column prefix, 8 blocks and one
+	// separator where the readings cross 12:01:00
+	s := &stats{min: time.Hour, timeAxis: true, markEvery: time.Minute}
+	start := time.Date(2026, 5, 17, 12, 0, 50, 0, time.Local)
+	for i := range 8 {
+		addBlock(s, "x", start.Add(time.Duration(i)*5*time.Second))
+	}
+	printDisplay(s)
+	if s.col != 18 || s.lineStart != 0 || s.lastPrinted != 8 {
+		t.Errorf("col/lineStart/lastPrinted = %d/%d/%d; want 18/0/8", s.col, s.lineStart, s.lastPrinted)
+	}
+	// Redrawing the line reproduces the same layout
+	redrawDisplay(s)
+	if s.col != 18 || s.lastPrinted != 8 {
+		t.Errorf("after redraw col/lastPrinted = %d/%d; want 18/8", s.col, s.lastPrinted)
+	}
+}
+
+// =============================================================================
+// Test: --until time of day
+// =============================================================================
+
+func TestParseUntil_TableDriven(t *testing.T) {
+	now := time.Date(2026, 5, 17, 14, 30, 0, 0, time.Local)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"18:00", time.Date(2026, 5, 17, 18, 0, 0, 0, time.Local), false},
+		{"14:30:01", time.Date(2026, 5, 17, 14, 30, 1, 0, time.Local), false},
+		{"14:30", time.Date(2026, 5, 18, 14, 30, 0, 0, time.Local), false}, // now: tomorrow
+		{"09:15", time.Date(2026, 5, 18, 9, 15, 0, 0, time.Local), false},
+		{"00:00", time.Date(2026, 5, 18, 0, 0, 0, 0, time.Local), false},
+		{"24:00", time.Time{}, true},
+		{"6pm", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseUntil(tt.in, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseUntil(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
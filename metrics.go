@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Latency histogram buckets (seconds) exposed on /metrics
+var metricBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// targetMetrics holds the Prometheus series for one target. Unlike stats,
+// these are never reset, so counters stay monotonic.
+type targetMetrics struct {
+	requests uint64
+	failures uint64
+	invalid  uint64
+	buckets  []uint64 // per-bucket (non-cumulative) counts; last is +Inf
+	sum      float64  // seconds
+	up       int      // 1 = UP, 0 = DOWN, -1 = no probe yet
+	proto    int
+}
+
+// metrics collects per-target series for the exporter. It has its own
+// lock so scrapes never wait on displayMu (held while suspended).
+type metrics struct {
+	mu      sync.Mutex
+	targets []*target
+	series  map[*target]*targetMetrics
+}
+
+func newMetrics(targets []*target) *metrics {
+	m := &metrics{targets: targets, series: map[*target]*targetMetrics{}}
+	for _, t := range targets {
+		m.series[t] = &targetMetrics{buckets: make([]uint64, len(metricBuckets)+1), up: -1, proto: t.proto}
+	}
+	return m
+}
+
+// observe records a result after it has been applied to r.t.s.
+func (m *metrics) observe(r result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tm := m.series[r.t]
+	tm.proto = r.proto
+	if r.switched {
+		return
+	}
+	tm.requests++
+	if r.err != nil {
+		tm.failures++
+		if isAssertError(r.err) {
+			tm.invalid++
+		}
+	} else {
+		sec := r.rtt.Seconds()
+		tm.sum += sec
+		i := 0
+		for i < len(metricBuckets) && sec > metricBuckets[i] {
+			i++
+		}
+		tm.buckets[i]++
+	}
+	if p := r.t.s.currentPeriod; p != nil && p.up {
+		tm.up = 1
+	} else {
+		tm.up = 0
+	}
+}
+
+// write renders all series in the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	family := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	family("hp_requests_total", "counter", "Probes sent.")
+	for _, t := range m.targets {
+		fmt.Fprintf(w, "hp_requests_total{target=%s} %d\n", quoteLabel(t.name()), m.series[t].requests)
+	}
+	family("hp_failures_total", "counter", "Probes that failed.")
+	for _, t := range m.targets {
+		fmt.Fprintf(w, "hp_failures_total{target=%s} %d\n", quoteLabel(t.name()), m.series[t].failures)
+	}
+
+	family("hp_invalid_total", "counter", "Failed probes whose response did not match --expect-* (subset of hp_failures_total).")
+	for _, t := range m.targets {
+		fmt.Fprintf(w, "hp_invalid_total{target=%s} %d\n", quoteLabel(t.name()), m.series[t].invalid)
+	}
+
+	family("hp_latency_seconds", "histogram", "Round-trip time of successful probes.")
+	for _, t := range m.targets {
+		tm := m.series[t]
+		label := quoteLabel(t.name())
+		var cum uint64
+		for i, le := range metricBuckets {
+			cum += tm.buckets[i]
+			fmt.Fprintf(w, "hp_latency_seconds_bucket{target=%s,le=\"%s\"} %d\n", label, strconv.FormatFloat(le, 'g', -1, 64), cum)
+		}
+		cum += tm.buckets[len(metricBuckets)]
+		fmt.Fprintf(w, "hp_latency_seconds_bucket{target=%s,le=\"+Inf\"} %d\n", label, cum)
+		fmt.Fprintf(w, "hp_latency_seconds_sum{target=%s} %s\n", label, strconv.FormatFloat(tm.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "hp_latency_seconds_count{target=%s} %d\n", label, cum)
+	}
+
+	family("hp_up", "gauge", "Current period state: 1 = UP, 0 = DOWN.")
+	for _, t := range m.targets {
+		if tm := m.series[t]; tm.up >= 0 {
+			fmt.Fprintf(w, "hp_up{target=%s} %d\n", quoteLabel(t.name()), tm.up)
+		}
+	}
+
+	family("hp_protocol_level", "gauge", "Active protocol level: 0 = HTTP/1.1, 1 = HTTPS, 2 = HTTP/2, 3 = HTTP/3.")
+	for _, t := range m.targets {
+		fmt.Fprintf(w, "hp_protocol_level{target=%s} %d\n", quoteLabel(t.name()), m.series[t].proto)
+	}
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// quoteLabel returns v as a quoted Prometheus label value.
+func quoteLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
+
+// serveMetrics starts the /metrics endpoint on addr. The listener is
+// opened synchronously so address errors are reported at startup.
+func serveMetrics(addr string, m *metrics) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	return nil
+}
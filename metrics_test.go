@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: Prometheus metrics
+// =============================================================================
+
+func TestMetrics_Write(t *testing.T) {
+	tg := &target{displayURL: "example.com", proto: protoHTTP2, s: &stats{min: time.Hour}}
+	m := newMetrics([]*target{tg})
+
+	for _, r := range []result{
+		{t: tg, proto: protoHTTP2, measurement: measurement{rtt: 20 * time.Millisecond}},
+		{t: tg, proto: protoHTTP2, measurement: measurement{rtt: 300 * time.Millisecond}},
+		{t: tg, proto: protoHTTP2, err: errors.New("timeout")},
+	} {
+		recordResult(tg.s, r.rtt, r.ph, r.err)
+		m.observe(r)
+	}
+	m.observe(result{t: tg, proto: protoHTTPS, switched: true, from: protoHTTP2})
+
+	var sb strings.Builder
+	m.write(&sb)
+	out := sb.String()
+
+	for _, want := range []string{
+		"# TYPE hp_requests_total counter\n",
+		`hp_requests_total{target="example.com"} 3` + "\n",
+		`hp_failures_total{target="example.com"} 1` + "\n",
+		"# TYPE hp_latency_seconds histogram\n",
+		`hp_latency_seconds_bucket{target="example.com",le="0.01"} 0` + "\n",
+		`hp_latency_seconds_bucket{target="example.com",le="0.025"} 1` + "\n",
+		`hp_latency_seconds_bucket{target="example.com",le="0.25"} 1` + "\n",
+		`hp_latency_seconds_bucket{target="example.com",le="0.5"} 2` + "\n",
+		`hp_latency_seconds_bucket{target="example.com",le="+Inf"} 2` + "\n",
+		`hp_latency_seconds_sum{target="example.com"} 0.32` + "\n",
+		`hp_latency_seconds_count{target="example.com"} 2` + "\n",
+		`hp_up{target="example.com"} 0` + "\n",
+		`hp_protocol_level{target="example.com"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetrics_OmitsUpBeforeFirstProbe(t *testing.T) {
+	tg := &target{displayURL: "example.com", s: &stats{min: time.Hour}}
+	var sb strings.Builder
+	newMetrics([]*target{tg}).write(&sb)
+	if strings.Contains(sb.String(), "hp_up{") {
+		t.Errorf("hp_up reported before any probe:\n%s", sb.String())
+	}
+}
+
+func TestQuoteLabel(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"example.com", `"example.com"`},
+		{`a"b`, `"a\"b"`},
+		{`a\b`, `"a\\b"`},
+		{"a\nb", `"a\nb"`},
+	}
+	for _, tt := range tests {
+		if got := quoteLabel(tt.in); got != tt.want {
+			t.Errorf("quoteLabel(%q) = %s; want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	tg := &target{displayURL: "example.com", s: &stats{min: time.Hour}}
+	m := newMetrics([]*target{tg})
+	if err := serveMetrics("127.0.0.1:0", m); err != nil {
+		t.Fatalf("serveMetrics: %v", err)
+	}
+	if err := serveMetrics("bad address", m); err == nil {
+		t.Error("serveMetrics accepted an invalid address")
+	}
+}
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	tg := &target{displayURL: "example.com", s: &stats{min: time.Hour}}
+	rec := httptest.NewRecorder()
+	newMetrics([]*target{tg}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "hp_requests_total") {
+		t.Errorf("body missing hp_requests_total:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Session recordings (--record, hp replay) are gzip-compressed NDJSON: a
+// header line describing the targets, then one short-keyed line per
+// probe or protocol switch. Each line is flushed as it is written, so a run
+// that is killed still leaves a readable file. "d" marks a protocol
+// switch, either way, with the previous level in "f".
+const (
+	recordFormat  = "hp-record"
+	recordVersion = 1
+)
+
+type recordHeader struct {
+	Format  string         `json:"format"`
+	Version int            `json:"version"`
+	HP      string         `json:"hp"`
+	Start   time.Time      `json:"start"`
+	Reuse   bool           `json:"reuse,omitempty"`
+	Targets []recordTarget `json:"targets"`
+}
+
+type recordTarget struct {
+	URL    string `json:"url"`
+	Label  string `json:"label,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	Proto  int    `json:"proto"`
+	Family int    `json:"family,omitempty"`
+}
+
+// recordEntry is one result. Times are offsets from the header start and
+// durations are microseconds, to keep lines short.
+type recordEntry struct {
+	T          int64        `json:"t"`           // ms since start
+	Target     int          `json:"i,omitempty"` // index into the header targets
+	Seq        int          `json:"n,omitempty"`
+	Proto      int          `json:"p"`
+	RTT        int64        `json:"r,omitempty"`
+	Status     int          `json:"s,omitempty"`
+	Phases     []int64      `json:"ph,omitempty"` // dns, tcp, tls, ttfb
+	Reused     bool         `json:"re,omitempty"`
+	Warmup     bool         `json:"w,omitempty"` // --warmup probe, not counted
+	Err        string       `json:"e,omitempty"`
+	Invalid    bool         `json:"x,omitempty"` // Err is an --expect-* failure
+	AltSvc     string       `json:"as,omitempty"`
+	Remote     string       `json:"ra,omitempty"`  // IP that carried the request
+	TLS        *recordedTLS `json:"tls,omitempty"` // only when it differs from the target's previous entry
+	Switched   bool         `json:"d,omitempty"`   // protocol switch notice
+	From       int          `json:"f,omitempty"`   // with d: previous protocol
+	Advertised bool         `json:"ad,omitempty"`  // with d: prompted by Alt-Svc
+}
+
+// recordedTLS is a probe's TLS state.
+type recordedTLS struct {
+	Version  uint16   `json:"v"`
+	Cipher   uint16   `json:"c"`
+	ALPN     string   `json:"a,omitempty"`
+	Chain    []string `json:"ch,omitempty"`
+	NotAfter int64    `json:"na,omitempty"` // leaf expiry, Unix seconds
+	SHA256   string   `json:"fp,omitempty"`
+}
+
+// recorder appends results to a --record file. The results loop writes
+// and finish closes it, both with displayMu held.
+type recorder struct {
+	f       *os.File
+	gz      *gzip.Writer
+	enc     *json.Encoder
+	start   time.Time
+	lastTLS map[int]*tlsInfo // last TLS state written per target
+	err     error            // first write error; recording stops there
+}
+
+// newRecorder creates path (truncating it) and writes the header.
+func newRecorder(path string, targets []*target, o *options) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	rec := &recorder{f: f, gz: gz, enc: json.NewEncoder(gz), start: time.Now(), lastTLS: map[int]*tlsInfo{}}
+	hdr := recordHeader{Format: recordFormat, Version: recordVersion, HP: version, Start: rec.start, Reuse: o.reuse}
+	for _, t := range targets {
+		hdr.Targets = append(hdr.Targets, recordTarget{URL: t.displayURL, Label: t.label, IP: t.resolvedIP, Proto: t.proto, Family: t.family})
+	}
+	if err := rec.put(hdr); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (rec *recorder) put(v any) error {
+	if err := rec.enc.Encode(v); err != nil {
+		return err
+	}
+	return rec.gz.Flush()
+}
+
+// write appends r. After the first error it does nothing; close reports it.
+func (rec *recorder) write(r result) {
+	if rec.err != nil {
+		return
+	}
+	e := recordEntry{
+		T:          r.at.Sub(rec.start).Milliseconds(),
+		Target:     r.t.idx,
+		Seq:        r.seq,
+		Proto:      r.proto,
+		Switched:   r.switched,
+		From:       r.from,
+		Advertised: r.advertised,
+		Warmup:     r.warmup,
+	}
+	if !r.switched {
+		e.Status = r.status
+		e.AltSvc = r.altSvc
+		e.Remote = r.remote
+		if r.err != nil {
+			e.Err = r.err.Error()
+			e.Invalid = isAssertError(r.err)
+		}
+		if r.err == nil || e.Invalid {
+			e.RTT = r.rtt.Microseconds()
+		}
+		if r.err == nil {
+			for _, d := range r.ph.values() {
+				e.Phases = append(e.Phases, d.Microseconds())
+			}
+			e.Reused = r.ph.reused
+		}
+		if r.tls != nil && !r.tls.sameHeader(rec.lastTLS[r.t.idx]) {
+			e.TLS = &recordedTLS{Version: r.tls.version, Cipher: r.tls.cipher, ALPN: r.tls.alpn, Chain: r.tls.chain, SHA256: r.tls.fingerprint}
+			if !r.tls.notAfter.IsZero() {
+				e.TLS.NotAfter = r.tls.notAfter.Unix()
+			}
+			rec.lastTLS[r.t.idx] = r.tls
+		}
+	}
+	rec.err = rec.put(e)
+}
+
+// close finishes the gzip stream and returns the first error seen.
+func (rec *recorder) close() error {
+	err := rec.err
+	if cerr := rec.gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := rec.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// recording is an open --record file being replayed.
+type recording struct {
+	recordHeader
+	f   *os.File
+	dec *json.Decoder
+}
+
+// openRecording opens path and reads its header.
+func openRecording(path string) (*recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: not an hp recording: %v", path, err)
+	}
+	rc := &recording{f: f, dec: json.NewDecoder(gz)}
+	if err := rc.dec.Decode(&rc.recordHeader); err != nil || rc.Format != recordFormat {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: not an hp recording", path)
+	}
+	if rc.Version > recordVersion {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: recording format v%d is newer than this hp supports (v%d)", path, rc.Version, recordVersion)
+	}
+	if len(rc.Targets) == 0 {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: recording has no targets", path)
+	}
+	return rc, nil
+}
+
+// targets rebuilds the recorded targets without resolving anything.
+func (rc *recording) targets(o *options) []*target {
+	var targets []*target
+	for i, rt := range rc.Targets {
+		s := newStats(o)
+		s.reuse = rc.Reuse
+		// The URL is host plus path, the path (if any) starting with "/"
+		host, path, _ := strings.Cut(rt.URL, "/")
+		if path != "" {
+			path = "/" + path
+		}
+		targets = append(targets, &target{
+			idx:        i,
+			host:       host,
+			path:       path,
+			displayURL: rt.URL,
+			label:      rt.Label,
+			resolvedIP: rt.IP,
+			proto:      rt.Proto,
+			family:     rt.Family,
+			s:          s,
+		})
+	}
+	return targets
+}
+
+// replay sends every recorded result to results. A truncated final line
+// (from a killed run) ends the replay quietly; any other read error is
+// returned.
+func (rc *recording) replay(targets []*target, results chan<- result) error {
+	defer func() { _ = rc.f.Close() }()
+	for {
+		var e recordEntry
+		if err := rc.dec.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		if e.Target < 0 || e.Target >= len(targets) {
+			return fmt.Errorf("record refers to unknown target %d", e.Target)
+		}
+		r := result{
+			t:          targets[e.Target],
+			seq:        e.Seq,
+			at:         rc.Start.Add(time.Duration(e.T) * time.Millisecond),
+			proto:      e.Proto,
+			switched:   e.Switched,
+			from:       e.From,
+			advertised: e.Advertised,
+			warmup:     e.Warmup,
+		}
+		r.rtt = time.Duration(e.RTT) * time.Microsecond
+		r.status = e.Status
+		r.altSvc = e.AltSvc
+		r.remote = e.Remote
+		if e.TLS != nil {
+			r.tls = &tlsInfo{version: e.TLS.Version, cipher: e.TLS.Cipher, alpn: e.TLS.ALPN, chain: e.TLS.Chain, fingerprint: e.TLS.SHA256}
+			if e.TLS.NotAfter != 0 {
+				r.tls.notAfter = time.Unix(e.TLS.NotAfter, 0)
+			}
+		}
+		if len(e.Phases) == 4 {
+			r.ph = phases{
+				dns:     time.Duration(e.Phases[0]) * time.Microsecond,
+				connect: time.Duration(e.Phases[1]) * time.Microsecond,
+				tls:     time.Duration(e.Phases[2]) * time.Microsecond,
+				ttfb:    time.Duration(e.Phases[3]) * time.Microsecond,
+			}
+		}
+		r.ph.reused = e.Reused
+		switch {
+		case e.Invalid:
+			r.err = &assertError{e.Err}
+		case e.Err != "":
+			r.err = errors.New(e.Err)
+		}
+		results <- r
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: session recording and replay
+// =============================================================================
+
+func TestRecorder_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.hpz")
+	o := &options{reuse: true}
+	live := []*target{
+		{idx: 0, displayURL: "example.com/healthz", resolvedIP: "192.0.2.1", proto: protoHTTPS},
+		{idx: 1, displayURL: "10.0.0.1", proto: protoHTTP3},
+	}
+	rec, err := newRecorder(path, live, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := rec.start.Add(1500 * time.Millisecond)
+	ph := phases{dns: 1 * time.Millisecond, connect: 2 * time.Millisecond, tls: 3 * time.Millisecond, ttfb: 4 * time.Millisecond, reused: true}
+	sent := []result{
+		{t: live[0], seq: 1, at: at, proto: protoHTTPS, measurement: measurement{rtt: 12345 * time.Microsecond, ph: ph, status: 200, altSvc: `h3=":443"`, remote: "192.0.2.7"}},
+		{t: live[1], seq: 1, at: at, proto: protoHTTP3, err: errors.New("timeout")},
+		{t: live[1], at: at, proto: protoHTTP2, switched: true, from: protoHTTP3},
+		{t: live[0], at: at, proto: protoHTTP3, switched: true, from: protoHTTPS, advertised: true},
+		{t: live[0], seq: 2, at: at, proto: protoHTTPS, measurement: measurement{rtt: 5 * time.Millisecond, status: 503}, err: &assertError{"unexpected status 503"}},
+	}
+	for _, r := range sent {
+		rec.write(r)
+	}
+	if err := rec.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	rc, err := openRecording(path)
+	if err != nil {
+		t.Fatalf("openRecording: %v", err)
+	}
+	if !rc.Reuse || len(rc.Targets) != 2 || rc.Targets[0] != (recordTarget{URL: "example.com/healthz", IP: "192.0.2.1", Proto: protoHTTPS}) {
+		t.Errorf("header = %+v", rc.recordHeader)
+	}
+	targets := rc.targets(&options{braille: true})
+	if targets[0].host != "example.com" || targets[0].path != "/healthz" || targets[0].displayURL != "example.com/healthz" {
+		t.Errorf("target 0 host/path/display = %q/%q/%q; want the URL split at the path", targets[0].host, targets[0].path, targets[0].displayURL)
+	}
+	if !targets[0].s.reuse || !targets[0].s.braille || targets[1].proto != protoHTTP3 {
+		t.Errorf("targets not rebuilt from header: %+v", targets[1])
+	}
+
+	results := make(chan result, len(sent))
+	if err := rc.replay(targets, results); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	close(results)
+	var got []result
+	for r := range results {
+		got = append(got, r)
+	}
+	if len(got) != len(sent) {
+		t.Fatalf("replayed %d results; want %d", len(got), len(sent))
+	}
+	for i, r := range got {
+		want := sent[i]
+		if r.t != targets[want.t.idx] || r.seq != want.seq || r.proto != want.proto || r.switched != want.switched || r.from != want.from || r.advertised != want.advertised || r.altSvc != want.altSvc || r.remote != want.remote ||
+			r.rtt != want.rtt || r.status != want.status || r.ph != want.ph || !r.at.Equal(want.at) {
+			t.Errorf("result %d = %+v; want %+v", i, r, want)
+		}
+		if (r.err == nil) != (want.err == nil) || r.err != nil && (r.err.Error() != want.err.Error() || isAssertError(r.err) != isAssertError(want.err)) {
+			t.Errorf("result %d err = %v; want %v", i, r.err, want.err)
+		}
+	}
+}
+
+func TestReplay_TruncatedFile(t *testing.T) {
+	// A killed run leaves no gzip trailer; everything flushed still replays
+	path := filepath.Join(t.TempDir(), "killed.hpz")
+	tg := &target{displayURL: "example.com"}
+	rec, err := newRecorder(path, []*target{tg}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := 1; seq <= 3; seq++ {
+		rec.write(result{t: tg, seq: seq, at: time.Now(), measurement: measurement{rtt: time.Millisecond}})
+	}
+	_ = rec.f.Close() // no gz.Close
+
+	rc, err := openRecording(path)
+	if err != nil {
+		t.Fatalf("openRecording: %v", err)
+	}
+	results := make(chan result, 3)
+	if err := rc.replay(rc.targets(&options{}), results); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("replayed %d results; want 3", len(results))
+	}
+}
+
+func TestOpenRecording_Rejects(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, header any) string {
+		path := filepath.Join(dir, name)
+		f, _ := os.Create(path)
+		gz := gzip.NewWriter(f)
+		_ = json.NewEncoder(gz).Encode(header)
+		_ = gz.Close()
+		_ = f.Close()
+		return path
+	}
+	plain := filepath.Join(dir, "plain.txt")
+	_ = os.WriteFile(plain, []byte("hello"), 0o600)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"missing", filepath.Join(dir, "missing.hpz"), "missing.hpz"},
+		{"not gzip", plain, "not an hp recording"},
+		{"wrong format", write("other.hpz", map[string]any{"format": "other"}), "not an hp recording"},
+		{"newer version", write("new.hpz", recordHeader{Format: recordFormat, Version: recordVersion + 1, Targets: []recordTarget{{URL: "x"}}}), "newer"},
+		{"no targets", write("empty.hpz", recordHeader{Format: recordFormat, Version: recordVersion}), "no targets"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := openRecording(tc.path)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("openRecording = %v; want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// requestSpec describes the probe request built from -X, -H, --data,
+// --data-file and --user-agent, and the checks applied to its response.
+// The zero value sends a bare HEAD.
+type requestSpec struct {
+	method string
+	header http.Header
+	host   string // Host header override (from -H "Host: ...")
+	body   []byte
+	expect *expectations // nil = any response is a success
+}
+
+// newRequestSpec validates the request flags. The method defaults to HEAD,
+// or POST when a body is given (like curl -d).
+func newRequestSpec(method string, headers []string, data, dataFile, userAgent string) (*requestSpec, error) {
+	rs := &requestSpec{method: strings.ToUpper(method), header: http.Header{}}
+
+	if data != "" && dataFile != "" {
+		return nil, fmt.Errorf("--data and --data-file are mutually exclusive")
+	}
+	if data != "" {
+		rs.body = []byte(data)
+	}
+	if dataFile != "" {
+		b, err := os.ReadFile(dataFile)
+		if err != nil {
+			return nil, fmt.Errorf("--data-file: %w", err)
+		}
+		rs.body = b
+	}
+	if rs.method == "" {
+		rs.method = http.MethodHead
+		if rs.body != nil {
+			rs.method = http.MethodPost
+		}
+	}
+
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header %q (want \"Name: value\")", h)
+		}
+		value = strings.TrimSpace(value)
+		if textproto.CanonicalMIMEHeaderKey(name) == "Host" {
+			rs.host = value
+			continue
+		}
+		rs.header.Add(name, value)
+	}
+	if userAgent != "" {
+		rs.header.Set("User-Agent", userAgent)
+	}
+	return rs, nil
+}
+
+// newRequest builds a fresh request for url. A nil spec sends HEAD.
+func (rs *requestSpec) newRequest(url string) (*http.Request, error) {
+	if rs == nil {
+		return http.NewRequest(http.MethodHead, url, nil)
+	}
+	var req *http.Request
+	var err error
+	if rs.body != nil {
+		req, err = http.NewRequest(rs.method, url, bytes.NewReader(rs.body))
+	} else {
+		req, err = http.NewRequest(rs.method, url, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range rs.header {
+		req.Header[k] = v
+	}
+	if rs.host != "" {
+		req.Host = rs.host
+	}
+	return req, nil
+}
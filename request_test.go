@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: request method, headers and body
+// =============================================================================
+
+func TestNewRequestSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		headers    []string
+		data       string
+		ua         string
+		wantMethod string
+		wantHeader map[string]string
+		wantHost   string
+		wantErr    bool
+	}{
+		{name: "default", wantMethod: "HEAD"},
+		{name: "explicit method", method: "get", wantMethod: "GET"},
+		{name: "data implies POST", data: `{"a":1}`, wantMethod: "POST"},
+		{name: "data with method", method: "PUT", data: "x", wantMethod: "PUT"},
+		{name: "headers", headers: []string{"Authorization: Bearer abc", "x-foo:bar", "X-Foo: baz"}, wantMethod: "HEAD",
+			wantHeader: map[string]string{"Authorization": "Bearer abc", "X-Foo": "bar"}},
+		{name: "host header", headers: []string{"Host: internal.example"}, wantMethod: "HEAD", wantHost: "internal.example"},
+		{name: "user agent", ua: "probe/1.0", headers: []string{"User-Agent: other"}, wantMethod: "HEAD",
+			wantHeader: map[string]string{"User-Agent": "probe/1.0"}},
+		{name: "missing colon", headers: []string{"Authorization Bearer"}, wantErr: true},
+		{name: "empty name", headers: []string{": value"}, wantErr: true},
+		{name: "space in name", headers: []string{"X Foo: bar"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := newRequestSpec(tt.method, tt.headers, tt.data, "", tt.ua)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if rs.method != tt.wantMethod {
+				t.Errorf("method = %q; want %q", rs.method, tt.wantMethod)
+			}
+			for k, v := range tt.wantHeader {
+				if got := rs.header.Get(k); got != v {
+					t.Errorf("header %s = %q; want %q", k, got, v)
+				}
+			}
+			if rs.host != tt.wantHost {
+				t.Errorf("host = %q; want %q", rs.host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestNewRequestSpec_DataFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(path, []byte(`{"ping":true}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := newRequestSpec("", nil, "", path, "")
+	if err != nil {
+		t.Fatalf("newRequestSpec: %v", err)
+	}
+	if rs.method != "POST" || string(rs.body) != `{"ping":true}` {
+		t.Errorf("method/body = %q/%q", rs.method, rs.body)
+	}
+	if _, err := newRequestSpec("", nil, "x", path, ""); err == nil {
+		t.Error("--data with --data-file accepted")
+	}
+	if _, err := newRequestSpec("", nil, "", filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("missing --data-file accepted")
+	}
+}
+
+func TestMeasureRTT_SendsRequestSpec(t *testing.T) {
+	type seen struct {
+		method, path, auth, ua, host, body string
+	}
+	got := make(chan seen, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got <- seen{r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), r.Header.Get("User-Agent"), r.Host, string(b)}
+	}))
+	defer srv.Close()
+
+	rs, err := newRequestSpec("", []string{"Authorization: Bearer abc", "Host: svc.internal"}, "hello", "", "hp-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := createClient(protoHTTP1, &options{timeout: 5 * time.Second})
+	// Reuse the spec twice: the body must be sent on every probe
+	for range 2 {
+		if _, err := measureRTT(client, srv.URL+"/healthz?full=1", protoHTTP1, rs); err != nil {
+			t.Fatalf("measureRTT: %v", err)
+		}
+		want := seen{"POST", "/healthz?full=1", "Bearer abc", "hp-test", "svc.internal", "hello"}
+		if s := <-got; s != want {
+			t.Errorf("server saw %+v; want %+v", s, want)
+		}
+	}
+}
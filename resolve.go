@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+)
+
+// dialOverrides redirects connections the way curl's --resolve and
+// --connect-to do: the URL, Host header and TLS server name stay those of
+// the target, only the address dialed changes. A nil *dialOverrides
+// leaves every address alone.
+type dialOverrides struct {
+	connectTo []connectTo
+	resolve   map[string]string // "host:port" -> address to dial instead
+}
+
+// connectTo is one --connect-to HOST1:PORT1:HOST2:PORT2 rule. Empty
+// fields match any host/port (HOST1, PORT1) or keep it (HOST2, PORT2).
+type connectTo struct {
+	fromHost, fromPort string
+	toHost, toPort     string
+}
+
+// newDialOverrides parses --resolve host:port:addr and --connect-to
+// HOST1:PORT1:HOST2:PORT2 values. It returns nil if both are empty.
+func newDialOverrides(resolve, connect []string) (*dialOverrides, error) {
+	if len(resolve) == 0 && len(connect) == 0 {
+		return nil, nil
+	}
+	ov := &dialOverrides{resolve: map[string]string{}}
+	for _, v := range resolve {
+		f, err := splitColons(v, 3)
+		if err != nil || f[0] == "" || f[2] == "" || !validPort(f[1]) || net.ParseIP(f[2]) == nil {
+			return nil, fmt.Errorf("invalid --resolve %q (want host:port:addr)", v)
+		}
+		ov.resolve[net.JoinHostPort(strings.ToLower(f[0]), f[1])] = net.JoinHostPort(f[2], f[1])
+	}
+	for _, v := range connect {
+		f, err := splitColons(v, 4)
+		if err != nil || f[1] != "" && !validPort(f[1]) || f[3] != "" && !validPort(f[3]) {
+			return nil, fmt.Errorf("invalid --connect-to %q (want HOST1:PORT1:HOST2:PORT2)", v)
+		}
+		ov.connectTo = append(ov.connectTo, connectTo{strings.ToLower(f[0]), f[1], f[2], f[3]})
+	}
+	return ov, nil
+}
+
+// addr returns the address to dial for addr ("host:port"). The first
+// matching --connect-to rule applies, then --resolve for its result.
+func (ov *dialOverrides) addr(addr string) string {
+	if ov == nil {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	host = strings.ToLower(host)
+	for _, c := range ov.connectTo {
+		if (c.fromHost == "" || c.fromHost == host) && (c.fromPort == "" || c.fromPort == port) {
+			if c.toHost != "" {
+				host = c.toHost
+			}
+			if c.toPort != "" {
+				port = c.toPort
+			}
+			break
+		}
+	}
+	addr = net.JoinHostPort(host, port)
+	if to, ok := ov.resolve[addr]; ok {
+		return to
+	}
+	return addr
+}
+
+// familyNetwork narrows a network name ("tcp", "udp", "ip") to one
+// address family; family 0 leaves it as is.
+func familyNetwork(network string, family int) string {
+	if family == 0 {
+		return network
+	}
+	return network + strconv.Itoa(family)
+}
+
+// familyName returns "IPv4" or "IPv6" for family 4 or 6.
+func familyName(family int) string {
+	if family == 0 {
+		return ""
+	}
+	return "IPv" + strconv.Itoa(family)
+}
+
+// ipFamily returns 4 or 6 for ip.
+func ipFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+// addrFamily returns the family of the address that carried t's last
+// probe, or the one forced with -4/-6 before any probe (0 = unknown).
+func (t *target) addrFamily() int {
+	if ip := net.ParseIP(t.dialed); ip != nil {
+		return ipFamily(ip)
+	}
+	return t.family
+}
+
+// probeFamily returns the family of the address that carried r, falling
+// back to the one forced for its target (0 = unknown).
+func probeFamily(r result) int {
+	if ip := net.ParseIP(r.remote); ip != nil {
+		return ipFamily(ip)
+	}
+	return r.t.family
+}
+
+// noteDialed records ip as the address that carried t's latest probe and
+// reports whether the address shown for t changed.
+func (t *target) noteDialed(ip string) bool {
+	if ip == "" || ip == t.dialed {
+		return false
+	}
+	before := addrText(t)
+	t.dialed = ip
+	return addrText(t) != before
+}
+
+// dialQUIC dials an HTTP/3 server at addr, applying o's dial overrides
+// and address family. The lookup runs on ctx, so it shows up in the
+// request's httptrace DNS phase.
+func dialQUIC(ctx context.Context, o *options, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	addr = o.overrides.addr(addr)
+	if o.family != 0 {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, familyNetwork("ip", o.family), host)
+		if err != nil {
+			return nil, err
+		}
+		addr = net.JoinHostPort(ips[0].Unmap().String(), port)
+	}
+	return quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+}
+
+// splitColons splits s into exactly n colon-separated fields, treating a
+// [bracketed] IPv6 address as a single field (brackets removed).
+func splitColons(s string, n int) ([]string, error) {
+	var fields []string
+	for len(fields) < n-1 {
+		var f string
+		if strings.HasPrefix(s, "[") {
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, errors.New("missing ]")
+			}
+			f, s = s[1:end], s[end+1:]
+			if !strings.HasPrefix(s, ":") {
+				return nil, errors.New("missing :")
+			}
+			s = s[1:]
+		} else {
+			i := strings.Index(s, ":")
+			if i < 0 {
+				return nil, errors.New("missing :")
+			}
+			f, s = s[:i], s[i+1:]
+		}
+		fields = append(fields, f)
+	}
+	return append(fields, strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")), nil
+}
+
+func validPort(p string) bool {
+	n, err := strconv.Atoi(p)
+	return err == nil && n > 0 && n <= 65535
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// =============================================================================
+// Test: --resolve / --connect-to
+// =============================================================================
+
+func TestDialOverrides_Addr(t *testing.T) {
+	ov, err := newDialOverrides(
+		[]string{"api.example.com:443:10.0.0.5", "v6.example.com:443:[2001:db8::1]", "node.internal:8443:10.0.0.9"},
+		[]string{"lb.example.com:443:node.internal:8443", "api.example.com:80:alt.example.com:", "[::1]:80:localhost:8080"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"api.example.com:443", "10.0.0.5:443"},
+		{"API.example.com:443", "10.0.0.5:443"},
+		{"api.example.com:80", "alt.example.com:80"}, // empty PORT2 keeps the port
+		{"v6.example.com:443", "[2001:db8::1]:443"},
+		{"lb.example.com:443", "10.0.0.9:8443"}, // --connect-to, then --resolve
+		{"[::1]:80", "localhost:8080"},
+	}
+	for _, tt := range tests {
+		if got := ov.addr(tt.addr); got != tt.want {
+			t.Errorf("addr(%q) = %q; want %q", tt.addr, got, tt.want)
+		}
+	}
+	// Empty HOST1 and PORT1 match anything
+	all, _ := newDialOverrides(nil, []string{"::fallback.example.com:"})
+	if got := all.addr("other.example.com:443"); got != "fallback.example.com:443" {
+		t.Errorf("wildcard --connect-to = %q; want fallback.example.com:443", got)
+	}
+	var none *dialOverrides
+	if got := none.addr("example.com:443"); got != "example.com:443" {
+		t.Errorf("nil overrides changed the address: %q", got)
+	}
+}
+
+func TestNewDialOverrides_Rejects(t *testing.T) {
+	tests := []struct {
+		resolve, connect string
+	}{
+		{resolve: "example.com:443"},
+		{resolve: "example.com:https:10.0.0.1"},
+		{resolve: "example.com:443:not-an-ip"},
+		{resolve: ":443:10.0.0.1"},
+		{connect: "example.com:443:other"},
+		{connect: "example.com:x::"},
+		{connect: "[::1:443::"},
+	}
+	for _, tt := range tests {
+		var resolve, connect []string
+		if tt.resolve != "" {
+			resolve = []string{tt.resolve}
+		}
+		if tt.connect != "" {
+			connect = []string{tt.connect}
+		}
+		if _, err := newDialOverrides(resolve, connect); err == nil {
+			t.Errorf("newDialOverrides(%q, %q) = nil error", tt.resolve, tt.connect)
+		}
+	}
+}
+
+func TestDialOverrides_KeepHostAndSNI(t *testing.T) {
+	// Both servers only exist on 127.0.0.1; requests must still name the origin
+	var gotHost, gotSNI []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = append(gotHost, r.Host)
+		gotSNI = append(gotSNI, r.TLS.ServerName)
+	})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.StartTLS()
+	defer srv.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = udp.Close() }()
+	h3srv := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(srv.TLS)}
+	go func() { _ = h3srv.Serve(udp) }()
+	defer func() { _ = h3srv.Close() }()
+
+	_, tcpPort, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	udpPort := udp.LocalAddr().(*net.UDPAddr).Port
+	ov, err := newDialOverrides(
+		[]string{"origin.test:" + tcpPort + ":127.0.0.1"},
+		[]string{fmt.Sprintf("origin.test:443:127.0.0.1:%d", udpPort)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &options{timeout: 5 * time.Second, insecure: true, overrides: ov}
+
+	tcp, err := newTarget("origin.test:"+tcpPort, protoHTTPS, o)
+	if err != nil {
+		t.Fatalf("newTarget: %v", err)
+	}
+	if tcp.resolvedIP != "127.0.0.1" {
+		t.Errorf("resolvedIP = %q; want the --resolve address", tcp.resolvedIP)
+	}
+	quic, err := newTarget("origin.test", protoHTTP3, o)
+	if err != nil {
+		t.Fatalf("newTarget: %v", err)
+	}
+	if want := fmt.Sprintf("127.0.0.1:%d", udpPort); quic.resolvedIP != want {
+		t.Errorf("resolvedIP = %q; want %q", quic.resolvedIP, want)
+	}
+
+	for _, tg := range []*target{tcp, quic} {
+		if _, err := measureRTT(createClient(tg.proto, o), tg.urlFor(tg.proto), tg.proto, nil); err != nil {
+			t.Fatalf("%s probe: %v", protoNames[tg.proto], err)
+		}
+	}
+	if len(gotHost) != 2 || gotHost[0] != "origin.test:"+tcpPort || gotHost[1] != "origin.test" {
+		t.Errorf("Host headers = %q; want the origin", gotHost)
+	}
+	if strings.Join(gotSNI, ",") != "origin.test,origin.test" {
+		t.Errorf("SNI = %q; want origin.test", gotSNI)
+	}
+}
+
+// =============================================================================
+// Test: address family (-4/-6, --dual-stack)
+// =============================================================================
+
+func TestFamily_RestrictsDialer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	tests := []struct {
+		family int
+		wantOK bool
+	}{
+		{0, true},
+		{4, true},
+		{6, false}, // the server address is an IPv4 literal
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("family=%d", tt.family), func(t *testing.T) {
+			o := &options{timeout: 5 * time.Second, family: tt.family}
+			_, err := measureRTT(createClient(protoHTTP1, o), srv.URL, protoHTTP1, nil)
+			if (err == nil) != tt.wantOK {
+				t.Errorf("probe error = %v; want ok=%v", err, tt.wantOK)
+			}
+			if tt.family == 6 {
+				if _, err := dialQUIC(context.Background(), o, "127.0.0.1:1", nil, nil); err == nil || !strings.Contains(err.Error(), "127.0.0.1") {
+					t.Errorf("dialQUIC over IPv6 = %v; want a lookup error", err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTarget_Family(t *testing.T) {
+	tg, err := newTarget("127.0.0.1:8080", protoHTTP1, &options{family: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tg.family != 4 || addrText(&target{resolvedIP: "127.0.0.1", family: 4}) != "127.0.0.1 IPv4" {
+		t.Errorf("family = %d, addrText = %q", tg.family, addrText(tg))
+	}
+	if _, err := newTarget("127.0.0.1", protoHTTPS, &options{family: 6}); err == nil || !strings.Contains(err.Error(), "not an IPv6 address") {
+		t.Errorf("newTarget over IPv6 = %v; want a family mismatch", err)
+	}
+	if _, err := dualStackTargets("127.0.0.1", protoHTTPS, &options{}); err == nil {
+		t.Error("dualStackTargets of an IPv4 literal succeeded; want no IPv6 address")
+	}
+	if got := addrText(&target{resolvedIP: "::1", family: 6, label: "localhost IPv6"}); got != "::1" {
+		t.Errorf("addrText with a label = %q; want the bare address", got)
+	}
+}
+
+func TestCompareTargets_KeepFamily(t *testing.T) {
+	// Regression: compare targets dropped -6 and dialed 127.0.0.1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	ov, err := newDialOverrides([]string{"origin.test:" + port + ":127.0.0.1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &options{timeout: 5 * time.Second, count: 1, family: 6, overrides: ov, ctl: newControls(time.Millisecond)}
+	base, err := newTarget("origin.test:"+port, protoHTTPS, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg := compareTargets(base, o)[protoHTTP1]
+	if tg.family != 6 {
+		t.Fatalf("family = %d; want 6", tg.family)
+	}
+	for r := range startTarget(tg, o) {
+		if r.err == nil {
+			t.Errorf("probe %d over -6 reached the IPv4 server", r.seq)
+		}
+	}
+}
+
+func TestAddrText_ShowsDialedFamily(t *testing.T) {
+	// The resolver lists IPv6 first, but only IPv4 answers
+	lookupHost = func(string) ([]string, error) { return []string{"::1", "127.0.0.1"}, nil }
+	defer func() { lookupHost = net.LookupHost }()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	o := &options{timeout: 5 * time.Second, count: 1, ctl: newControls(time.Millisecond)}
+	tg, err := newTarget("localhost:"+port, protoHTTP1, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := addrText(tg); got != "::1" {
+		t.Errorf("addrText before probing = %q; want the first resolved address", got)
+	}
+	got := runProbes(t, "localhost:"+port, protoHTTP1, o)
+	if len(got) != 1 || got[0].err != nil || got[0].remote != "127.0.0.1" {
+		t.Fatalf("results = %+v; want one probe carried by 127.0.0.1", got)
+	}
+	if !tg.noteDialed(got[0].remote) || addrText(tg) != "127.0.0.1 IPv4" {
+		t.Errorf("addrText = %q; want the dialed address and its family", addrText(tg))
+	}
+	if line := probeLine(got[0], false); !strings.Contains(line, "HTTP/1.1 IPv4 ") {
+		t.Errorf("probeLine = %q; want the dialed family", line)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exit codes for SLO breaches. They are bit flags, so a run breaching
+// several limits exits with their sum (e.g. 6 = loss + p95). Exit code 1
+// stays reserved for usage and startup errors.
+const (
+	exitLoss = 2
+	exitP95  = 4
+	exitAvg  = 8
+)
+
+// slo holds the --max-* limits checked when a run ends. A zero latency
+// limit is disabled; --max-loss is only checked when given, so 0% means
+// no loss at all.
+type slo struct {
+	maxLoss float64 // percent
+	lossSet bool    // --max-loss was given
+	maxP95  time.Duration
+	maxAvg  time.Duration
+}
+
+// parsePercent parses "5%", "5" or "0.5%" as a percentage.
+func parsePercent(v string) (float64, error) {
+	p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+	if err != nil || p < 0 || p > 100 {
+		return 0, fmt.Errorf("invalid percentage %q", v)
+	}
+	return p, nil
+}
+
+// check compares s against the limits and returns the combined exit code
+// (0 if none was breached) with one reason per breach.
+func (l slo) check(s *stats) (int, []string) {
+	code := 0
+	var reasons []string
+	total := s.count + s.failures
+	if total == 0 {
+		return 0, nil
+	}
+	if l.lossSet {
+		if loss := float64(s.failures) * 100 / float64(total); loss > l.maxLoss {
+			code |= exitLoss
+			reasons = append(reasons, fmt.Sprintf("loss %.1f%% > %g%%", loss, l.maxLoss))
+		}
+	}
+	if s.count == 0 {
+		// No successful probe: a latency limit cannot be met
+		if l.maxP95 > 0 {
+			code |= exitP95
+			reasons = append(reasons, "p95 unknown (no successful probes)")
+		}
+		if l.maxAvg > 0 {
+			code |= exitAvg
+			reasons = append(reasons, "avg unknown (no successful probes)")
+		}
+		return code, reasons
+	}
+	if p95 := percentile(s, 0.95); l.maxP95 > 0 && p95 > l.maxP95 {
+		code |= exitP95
+		reasons = append(reasons, fmt.Sprintf("p95 %sms > %sms", fmtMs(p95), fmtMs(l.maxP95)))
+	}
+	if avg := s.total / time.Duration(s.count); l.maxAvg > 0 && avg > l.maxAvg {
+		code |= exitAvg
+		reasons = append(reasons, fmt.Sprintf("avg %sms > %sms", fmtMs(avg), fmtMs(l.maxAvg)))
+	}
+	return code, reasons
+}
+
+// sloLine formats the reasons for printFinal, or "" if nothing was breached.
+func sloLine(reasons []string) string {
+	if len(reasons) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s%sSLO breached:%s %s", red, bold, reset, strings.Join(reasons, ", "))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: SLO limits and exit codes
+// =============================================================================
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{"5%", 5, false},
+		{"5", 5, false},
+		{"0.5%", 0.5, false},
+		{" 10 % ", 0, true},
+		{"101%", 0, true},
+		{"-1", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePercent(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parsePercent(%q) = %v, %v; want %v, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// sloStats records ok RTTs (ms) followed by the given number of failures.
+func sloStats(rtts []int, failures int) *stats {
+	s := &stats{min: time.Hour}
+	for _, ms := range rtts {
+		recordResult(s, time.Duration(ms)*time.Millisecond, phases{}, nil)
+	}
+	for range failures {
+		recordResult(s, 0, phases{}, errors.New("timeout"))
+	}
+	return s
+}
+
+func TestSLO_Check(t *testing.T) {
+	rtts := []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 500}
+	tests := []struct {
+		name     string
+		lim      slo
+		s        *stats
+		wantCode int
+		wantText []string
+	}{
+		{"no limits", slo{}, sloStats(rtts, 5), 0, nil},
+		{"within limits", slo{maxLoss: 50, lossSet: true, maxP95: time.Second, maxAvg: time.Second}, sloStats(rtts, 0), 0, nil},
+		{"loss", slo{maxLoss: 5, lossSet: true}, sloStats(rtts, 1), exitLoss, []string{"loss 9.1% > 5%"}},
+		{"p95", slo{maxP95: 300 * time.Millisecond}, sloStats(rtts, 0), exitP95, []string{"p95 500ms > 300ms"}},
+		{"avg", slo{maxAvg: 120 * time.Millisecond}, sloStats(rtts, 0), exitAvg, []string{"avg 140ms > 120ms"}},
+		{"combined", slo{maxLoss: 5, lossSet: true, maxP95: 300 * time.Millisecond, maxAvg: 120 * time.Millisecond}, sloStats(rtts, 1),
+			exitLoss | exitP95 | exitAvg, []string{"loss", "p95", "avg"}},
+		{"all failed", slo{maxLoss: 5, lossSet: true, maxP95: time.Millisecond}, sloStats(nil, 3), exitLoss | exitP95, []string{"loss 100.0%", "p95 unknown"}},
+		{"all failed, latency limits only", slo{maxP95: time.Second, maxAvg: time.Second}, sloStats(nil, 3),
+			exitP95 | exitAvg, []string{"p95 unknown", "avg unknown"}},
+		{"zero loss tolerated", slo{maxLoss: 0, lossSet: true}, sloStats(rtts, 0), 0, nil},
+		{"zero loss breached", slo{maxLoss: 0, lossSet: true}, sloStats(rtts, 1), exitLoss, []string{"loss 9.1% > 0%"}},
+		{"no requests", slo{maxLoss: 5, lossSet: true}, sloStats(nil, 0), 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, reasons := tt.lim.check(tt.s)
+			if code != tt.wantCode {
+				t.Errorf("code = %d; want %d (reasons %v)", code, tt.wantCode, reasons)
+			}
+			if len(reasons) != len(tt.wantText) {
+				t.Fatalf("reasons = %v; want %d entries", reasons, len(tt.wantText))
+			}
+			for i, want := range tt.wantText {
+				if !strings.HasPrefix(reasons[i], want) {
+					t.Errorf("reason[%d] = %q; want prefix %q", i, reasons[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSLOLine(t *testing.T) {
+	if got := sloLine(nil); got != "" {
+		t.Errorf("sloLine(nil) = %q; want empty", got)
+	}
+	got := sloLine([]string{"loss 10.0% > 5%", "avg 200ms > 150ms"})
+	if !strings.Contains(got, "SLO breached:") || !strings.Contains(got, "loss 10.0% > 5%, avg 200ms > 150ms") {
+		t.Errorf("sloLine = %q", got)
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// options holds the settings shared by every target loop and view.
+type options struct {
+	jitter       time.Duration
+	timeout      time.Duration
+	count        int            // measured requests per target (0 = unlimited)
+	warmup       int            // leading probes per target left out of the stats, on top of count
+	maxInFlight  int            // concurrent probes per target (0 = 1, one at a time)
+	insecure     bool           // skip TLS certificate verification
+	tls          *tls.Config    // --cacert, --cert/--key, --tls-min/max, --sni (nil = defaults)
+	certWarn     time.Duration  // warn when the server certificate expires within this
+	reuse        bool           // keep one persistent connection per target
+	reuseEvery   int            // with reuse: reconnect every N requests (0 = never)
+	proxy        *url.URL       // explicit proxy (nil = use environment)
+	overrides    *dialOverrides // --resolve / --connect-to (nil = none)
+	family       int            // dial only IPv4 (4) or IPv6 (6); 0 = either
+	braille      bool
+	phaseBar     bool          // show phase breakdown as a stacked bar
+	timeAxis     bool          // prefix bar lines with HH:MM:SS
+	markEvery    time.Duration // bar separator interval (0 = none)
+	canDowngrade bool
+	minProto     int  // lowest protocol level downgrade may reach
+	downAfter    int  // consecutive failures that trigger a downgrade
+	upgradeEvery int  // after a downgrade, retry the original protocol every N probes (0 = never)
+	upgradeH3    bool // switch to HTTP/3 once a response advertises it via Alt-Svc
+	header       bool
+	legend       bool
+	summary      bool
+	ctl          *controls    // run-time controls (pause, interval)
+	slo          slo          // --max-* limits checked at exit
+	req          *requestSpec // method, headers and body of each probe
+}
+
+// target is a single monitored host. The probe loop owns the HTTP client;
+// everything else is owned by the display goroutine.
+type target struct {
+	idx        int    // position in the target list (multi-target row)
+	host       string // host used to build URLs (IPv6 wrapped in brackets)
+	path       string // path and query from the argument ("" = root)
+	displayURL string
+	label      string // overrides displayURL in bars, tables and metrics
+	resolvedIP string
+	proto      int     // protocol level currently shown for this target
+	h3         *altSvc // HTTP/3 advertised via Alt-Svc (nil = none seen)
+	family     int     // address family forced with -4/-6/--dual-stack (0 = either)
+	dialed     string  // IP that carried the last probe ("" = none yet)
+	s          *stats
+}
+
+// lookupHost resolves target hosts; tests swap it for a fixed answer.
+var lookupHost = net.LookupHost
+
+// name returns the label identifying t among the targets on screen.
+func (t *target) name() string {
+	if t.label != "" {
+		return t.label
+	}
+	return t.displayURL
+}
+
+// compareTargets expands base into one target per protocol level for
+// --compare-protocols. Each gets its own probe loop and client; the
+// lookup done for base is shared.
+func compareTargets(base *target, o *options) []*target {
+	var targets []*target
+	for p := protoHTTP1; p <= protoHTTP3; p++ {
+		targets = append(targets, &target{
+			idx:        p,
+			host:       base.host,
+			path:       base.path,
+			displayURL: base.displayURL,
+			label:      base.displayURL + " " + protoNames[p],
+			resolvedIP: base.resolvedIP,
+			proto:      p,
+			family:     base.family,
+			s:          newStats(o),
+		})
+	}
+	return targets
+}
+
+// dualStackTargets builds one target per address family for --dual-stack.
+// Each probe loop dials only its own family.
+func dualStackTargets(arg string, proto int, o *options) ([]*target, error) {
+	var targets []*target
+	for i, family := range []int{4, 6} {
+		of := *o
+		of.family = family
+		t, err := newTarget(arg, proto, &of)
+		if err != nil {
+			return nil, err
+		}
+		t.idx = i
+		t.label = t.displayURL + " " + familyName(family)
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// result is a probe outcome (or a protocol switch notice) sent from a
+// target loop to the display goroutine.
+type result struct {
+	t   *target
+	seq int       // per-target probe number, starting at 1
+	at  time.Time // when the probe was sent
+	measurement
+	err        error
+	proto      int  // protocol level the probe ran on (or was switched to)
+	switched   bool // true if this announces a protocol switch rather than a probe
+	from       int  // with switched: the previous protocol level
+	advertised bool // with switched: an --upgrade-h3 switch prompted by Alt-Svc
+	warmup     bool // one of the first --warmup probes: drawn but not counted
+}
+
+// upgraded reports whether a switch notice moved to a higher protocol.
+func (r result) upgraded() bool {
+	return r.switched && r.proto > r.from
+}
+
+// switchName names a switch notice: "upgrade" or "downgrade".
+func switchName(r result) string {
+	if r.upgraded() {
+		return "upgrade"
+	}
+	return "downgrade"
+}
+
+// newTarget parses a positional argument (host, host:port or URL with a
+// path) into a target and resolves the hostname for display (and to
+// validate that it exists).
+func newTarget(arg string, proto int, o *options) (*target, error) {
+	// Extract host (without scheme) for building URLs dynamically
+	host := strings.TrimPrefix(arg, "https://")
+	host = strings.TrimPrefix(host, "http://")
+
+	// Split off the path and query, if any
+	path := ""
+	if i := strings.IndexAny(host, "/?"); i >= 0 {
+		host, path = host[:i], host[i:]
+		if path[0] == '?' {
+			path = "/" + path
+		}
+	}
+
+	// Check if it's an IPv6 address that needs brackets
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+
+	t := &target{
+		host:       host,
+		path:       path,
+		displayURL: host + path,
+		proto:      proto,
+		family:     o.family,
+		s:          newStats(o),
+	}
+
+	// With --resolve or --connect-to, show the address actually dialed
+	// (without the port unless that changed too)
+	if o.overrides != nil {
+		hostPort := host
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			port := "443"
+			if proto == protoHTTP1 {
+				port = "80"
+			}
+			hostPort = net.JoinHostPort(strings.Trim(host, "[]"), port)
+		}
+		if addr := o.overrides.addr(hostPort); addr != strings.ToLower(hostPort) {
+			t.resolvedIP = addr
+			if h, p, _ := net.SplitHostPort(addr); strings.HasSuffix(hostPort, ":"+p) {
+				t.resolvedIP = h
+			}
+			return t, nil
+		}
+	}
+
+	// Skipped when a proxy is configured: the proxy resolves the host
+	// (e.g. socks5h), so the local resolver may legitimately fail.
+	// Drop the port and IPv6 brackets before resolving
+	hostForLookup := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostForLookup = h
+	}
+	hostForLookup = strings.TrimPrefix(strings.TrimSuffix(hostForLookup, "]"), "[")
+	if ip := net.ParseIP(hostForLookup); ip != nil {
+		if o.family != 0 && ipFamily(ip) != o.family {
+			return nil, fmt.Errorf("%s is not an %s address", hostForLookup, familyName(o.family))
+		}
+	} else if !proxyConfigured() && o.proxy == nil {
+		ips, err := lookupHost(hostForLookup)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %v", hostForLookup, err)
+		}
+		for _, a := range ips {
+			if o.family == 0 || ipFamily(net.ParseIP(a)) == o.family {
+				t.resolvedIP = a
+				break
+			}
+		}
+		if t.resolvedIP == "" && o.family != 0 {
+			return nil, fmt.Errorf("%s has no %s address", hostForLookup, familyName(o.family))
+		}
+	}
+	return t, nil
+}
+
+// urlFor returns the probe URL for t at the given protocol level.
+func (t *target) urlFor(proto int) string {
+	return getURLForProto(t.host, proto) + t.path
+}
+
+// runTarget probes t every interval until count is reached, sending each
+// outcome to results. It never touches t.s; stats belong to the display.
+// Probing is held while o.ctl is paused.
+func runTarget(t *target, o *options, results chan<- result) {
+	if t.family != o.family {
+		// --dual-stack: this loop dials only the target's family
+		of := *o
+		of.family = t.family
+		o = &of
+	}
+	proto := t.proto
+	url := t.urlFor(proto)
+	client := createClient(proto, o)
+	top := proto // level to re-upgrade to after a downgrade
+
+	// With --upgrade-h3, HTTP/3 clients dial the advertised alternative
+	h3Addr := ""
+	clientFor := func(p int) *http.Client {
+		if p == protoHTTP3 && h3Addr != "" {
+			return newAltSvcClient(o, h3Addr)
+		}
+		return createClient(p, o)
+	}
+
+	// Background upgrade probe, at most one in flight
+	type upgradeProbe struct {
+		client     *http.Client
+		err        error
+		advertised bool
+	}
+	upgrades := make(chan upgradeProbe, 1)
+	probing := false
+	sinceSwitch := 0
+	probeUpgrade := func(advertised bool) {
+		probing = true
+		p := top
+		go func() {
+			c := clientFor(p)
+			_, err := measureRTT(c, t.urlFor(p), p, o.req)
+			upgrades <- upgradeProbe{c, err, advertised}
+		}()
+	}
+
+	// Background downgrade search, at most one in flight
+	type downgradeSearch struct {
+		from   int // protocol level that kept failing
+		proto  int
+		client *http.Client
+		ok     bool
+	}
+	downgrades := make(chan downgradeSearch, 1)
+	searching := false
+	searchDowngrade := func() {
+		searching = true
+		from := proto
+		go func() {
+			p, c, ok := findWorkingProto(t, from, o)
+			downgrades <- downgradeSearch{from, p, c, ok}
+		}()
+	}
+
+	switchTo := func(p int, c *http.Client, advertised bool) {
+		client.CloseIdleConnections()
+		results <- result{t: t, at: time.Now(), proto: p, switched: true, from: proto, advertised: advertised}
+		proto, client = p, c
+		url = t.urlFor(proto)
+		sinceSwitch = 0
+	}
+
+	consecutiveFailures := 0
+
+	// handle acts on one result, in sequence order: downgrade after a run
+	// of failures, follow Alt-Svc, and schedule upgrade attempts
+	handle := func(r result) {
+		results <- r
+		if r.proto != proto {
+			return // launched before a protocol switch
+		}
+		sinceSwitch++
+		if r.err != nil && !isAssertError(r.err) {
+			consecutiveFailures++
+
+			// Downgrade after downAfter consecutive failures, at any point
+			// in the session. The search tries each lower protocol with
+			// the full timeout, so it runs in the background while the
+			// regular probes keep their cadence.
+			if o.canDowngrade && consecutiveFailures >= o.downAfter && proto > o.minProto && !searching {
+				consecutiveFailures = 0 // search again only after another run of failures
+				searchDowngrade()
+				return
+			}
+		} else {
+			// A response that fails --expect-* still proves the protocol works
+			consecutiveFailures = 0 // Reset on success
+		}
+
+		// The first Alt-Svc h3 advertisement makes HTTP/3 the level to
+		// upgrade to; from then on it is retried like after a downgrade
+		if o.upgradeH3 && top < protoHTTP3 && proto >= protoHTTPS && !probing {
+			if a, ok := parseAltSvc(r.altSvc); ok {
+				if !a.sameOrigin(t.host) {
+					h3Addr = a.authority(t.host)
+				}
+				top = protoHTTP3
+				probeUpgrade(true)
+			}
+		}
+
+		// While downgraded, retry the original protocol in the background
+		// so a slow or failing attempt never delays the regular probes
+		if proto < top && o.upgradeEvery > 0 && !probing && sinceSwitch%o.upgradeEvery == 0 {
+			probeUpgrade(false)
+		}
+	}
+
+	// Probes start on a fixed cadence and run concurrently, up to
+	// o.maxInFlight at a time, so a response that hangs until the timeout
+	// does not push back the ones after it. Completed probes wait in
+	// pending until every earlier one has been handled.
+	limit := max(o.maxInFlight, 1)
+	done := make(chan result, limit)
+	pending := map[int]result{}
+	inFlight := 0
+	handled := 0 // sequence number of the last handled result
+	seq := 0
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		// Only wait for the timer while there is a request left to send
+		// and a free slot to send it in, and not while paused; results
+		// keep being handled either way
+		var tick <-chan time.Time
+		resumed := o.ctl.resumed()
+		if o.count == 0 || seq < o.count+o.warmup {
+			if inFlight < limit && resumed == nil {
+				tick = timer.C
+			}
+		} else if inFlight == 0 && !searching {
+			return
+		}
+
+		select {
+		case <-resumed:
+			// Start the cadence again from now
+			next = time.Now()
+			timer.Reset(0)
+
+		case <-tick:
+			if o.ctl.resumed() != nil {
+				continue // paused since the check above; resuming re-arms the timer
+			}
+			if o.reuse && o.reuseEvery > 0 && seq > 0 && seq%o.reuseEvery == 0 {
+				client.CloseIdleConnections() // forced periodic reconnect
+			}
+			seq++
+			inFlight++
+			at := time.Now()
+			go func(n int, c *http.Client, url string, p int) {
+				m, err := measureRTT(c, url, p, o.req)
+				if !o.reuse {
+					// HTTP/3 pools QUIC connections regardless of keep-alive
+					// settings; drop them so every sample pays the handshake
+					c.CloseIdleConnections()
+				}
+				done <- result{t: t, seq: n, at: at, measurement: m, err: err, proto: p, warmup: n <= o.warmup}
+			}(seq, client, url, proto)
+
+			// Keep the cadence; after a wait for a free slot, start it
+			// again from now rather than catching up
+			step := o.ctl.getInterval()
+			if o.jitter > 0 {
+				step += time.Duration(rand.Int63n(int64(o.jitter)))
+			}
+			if next = next.Add(step); !next.After(at) {
+				next = at.Add(step)
+			}
+			timer.Reset(time.Until(next))
+
+		case r := <-done:
+			inFlight--
+			pending[r.seq] = r
+			for {
+				r, ok := pending[handled+1]
+				if !ok {
+					break
+				}
+				delete(pending, r.seq)
+				handled++
+				handle(r)
+			}
+
+		case d := <-downgrades:
+			searching = false
+			if d.ok && d.from == proto {
+				switchTo(d.proto, d.client, false)
+				consecutiveFailures = 0
+			} else if d.ok {
+				d.client.CloseIdleConnections()
+			}
+
+		case u := <-upgrades:
+			probing = false
+			if proto < top && (u.err == nil || isAssertError(u.err)) {
+				switchTo(top, u.client, u.advertised)
+				consecutiveFailures = 0
+			} else {
+				u.client.CloseIdleConnections()
+			}
+		}
+	}
+}
+
+// findWorkingProto tests each protocol level below proto (down to
+// o.minProto) and returns the first one that answers, with its client.
+func findWorkingProto(t *target, proto int, o *options) (int, *http.Client, bool) {
+	candidateProto := proto
+	for candidateProto > o.minProto {
+		// Try next lower protocol
+		switch candidateProto {
+		case protoHTTP3:
+			candidateProto = protoHTTP2
+		case protoHTTP2:
+			candidateProto = protoHTTPS
+		case protoHTTPS:
+			candidateProto = protoHTTP1
+		}
+
+		// Test this protocol silently
+		testURL := t.urlFor(candidateProto)
+		testClient := createClient(candidateProto, o)
+		if _, err := measureRTT(testClient, testURL, candidateProto, o.req); err == nil || isAssertError(err) {
+			return candidateProto, testClient, true
+		}
+		// Otherwise continue to even lower protocol
+	}
+	return 0, nil, false
+}
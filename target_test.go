@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// =============================================================================
+// Test: target parsing
+// =============================================================================
+
+func TestNewTarget_ParsesHostAndPath(t *testing.T) {
+	tests := []struct {
+		arg         string
+		wantHost    string
+		wantPath    string
+		wantDisplay string
+		wantURL     string
+	}{
+		{"1.1.1.1", "1.1.1.1", "", "1.1.1.1", "https://1.1.1.1"},
+		{"https://1.1.1.1/healthz", "1.1.1.1", "/healthz", "1.1.1.1/healthz", "https://1.1.1.1/healthz"},
+		{"http://127.0.0.1:8080/api/v1?x=1", "127.0.0.1:8080", "/api/v1?x=1", "127.0.0.1:8080/api/v1?x=1", "https://127.0.0.1:8080/api/v1?x=1"},
+		{"127.0.0.1?x=1", "127.0.0.1", "/?x=1", "127.0.0.1/?x=1", "https://127.0.0.1/?x=1"},
+		{"::1", "[::1]", "", "[::1]", "https://[::1]"},
+		{"[::1]:8443/status", "[::1]:8443", "/status", "[::1]:8443/status", "https://[::1]:8443/status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			tg, err := newTarget(tt.arg, protoHTTPS, &options{})
+			if err != nil {
+				t.Fatalf("newTarget: %v", err)
+			}
+			if tg.host != tt.wantHost || tg.path != tt.wantPath || tg.displayURL != tt.wantDisplay {
+				t.Errorf("host/path/display = %q/%q/%q; want %q/%q/%q", tg.host, tg.path, tg.displayURL, tt.wantHost, tt.wantPath, tt.wantDisplay)
+			}
+			if got := tg.urlFor(protoHTTPS); got != tt.wantURL {
+				t.Errorf("urlFor = %q; want %q", got, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestNewTarget_ResolvesHostWithPort(t *testing.T) {
+	// Regression: net.LookupHost was called with "host:port"
+	tg, err := newTarget("localhost:8765/healthz", protoHTTP1, &options{})
+	if err != nil {
+		t.Fatalf("newTarget: %v", err)
+	}
+	if tg.resolvedIP == "" {
+		t.Error("resolvedIP is empty; want localhost address")
+	}
+	if got := tg.urlFor(protoHTTP1); got != "http://localhost:8765/healthz" {
+		t.Errorf("urlFor = %q", got)
+	}
+}
+
+func TestCompareTargets_OnePerProtocol(t *testing.T) {
+	base := &target{host: "example.com:8443", path: "/healthz", displayURL: "example.com:8443/healthz", resolvedIP: "192.0.2.1"}
+	targets := compareTargets(base, &options{braille: true})
+	if len(targets) != len(protoNames) {
+		t.Fatalf("targets = %d; want %d", len(targets), len(protoNames))
+	}
+	for i, tg := range targets {
+		if tg.idx != i || tg.proto != i || tg.resolvedIP != base.resolvedIP || !tg.s.braille {
+			t.Errorf("target %d = %+v", i, tg)
+		}
+		if want := "example.com:8443/healthz " + protoNames[i]; tg.name() != want {
+			t.Errorf("target %d name = %q; want %q", i, tg.name(), want)
+		}
+		if tg.s == targets[0].s && i > 0 {
+			t.Errorf("target %d shares stats with target 0", i)
+		}
+	}
+	if got := targets[protoHTTP1].urlFor(protoHTTP1); got != "http://example.com:8443/healthz" {
+		t.Errorf("HTTP/1.1 url = %q", got)
+	}
+}
+
+// startProbes runs the probe loop for addr in the background and returns
+// its results channel, closed when the loop ends.
+func startProbes(t *testing.T, addr string, proto int, o *options) <-chan result {
+	t.Helper()
+	tg, err := newTarget(addr, proto, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startTarget(tg, o)
+}
+
+// startTarget runs the probe loop for tg in the background.
+func startTarget(tg *target, o *options) <-chan result {
+	results := make(chan result)
+	go func() {
+		runTarget(tg, o, results)
+		close(results)
+	}()
+	return results
+}
+
+// runProbes runs the probe loop for addr to completion and returns every
+// result in the order received.
+func runProbes(t *testing.T, addr string, proto int, o *options) []result {
+	t.Helper()
+	var got []result
+	for r := range startProbes(t, addr, proto, o) {
+		got = append(got, r)
+	}
+	return got
+}
+
+func TestRunTarget_ReuseEvery(t *testing.T) {
+	tests := []struct {
+		name      string
+		reuse     bool
+		every     int
+		wantConns int32
+	}{
+		{"no reuse", false, 0, 6},
+		{"reuse", true, 0, 1},
+		{"reuse every 2", true, 2, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conns atomic.Int32
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			srv.Config.ConnState = func(_ net.Conn, st http.ConnState) {
+				if st == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			srv.Start()
+			defer srv.Close()
+
+			o := &options{timeout: 5 * time.Second, count: 6, reuse: tt.reuse, reuseEvery: tt.every, ctl: newControls(time.Millisecond)}
+			results := runProbes(t, srv.Listener.Addr().String(), protoHTTP1, o)
+			for _, r := range results {
+				if r.err != nil {
+					t.Fatalf("probe %d: %v", r.seq, r.err)
+				}
+			}
+			if got := conns.Load(); got != tt.wantConns {
+				t.Errorf("connections = %d; want %d", got, tt.wantConns)
+			}
+		})
+	}
+}
+
+func TestRunTarget_DowngradesMidSessionAndUpgradesBack(t *testing.T) {
+	// HTTP/2 works for two requests, breaks for three, then recovers;
+	// HTTP/1.1 over TLS always works
+	var h2 atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			if n := h2.Add(1); n >= 3 && n <= 5 {
+				panic(http.ErrAbortHandler)
+			}
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	o := &options{timeout: 5 * time.Second, count: 14, insecure: true, canDowngrade: true, minProto: protoHTTPS,
+		downAfter: 2, upgradeEvery: 2, ctl: newControls(20 * time.Millisecond)}
+	results := runProbes(t, srv.Listener.Addr().String(), protoHTTP2, o)
+
+	var switches []result
+	var lastProto, okBefore int
+	for _, r := range results {
+		if r.switched {
+			switches = append(switches, r)
+			continue
+		}
+		if len(switches) == 0 && r.err == nil {
+			okBefore++
+		}
+		lastProto = r.proto
+	}
+	if okBefore < 2 {
+		t.Errorf("%d successes before the first switch; want a mid-session downgrade", okBefore)
+	}
+	if len(switches) != 2 || switches[0].upgraded() || switches[0].proto != protoHTTPS ||
+		!switches[1].upgraded() || switches[1].from != protoHTTPS || switches[1].proto != protoHTTP2 {
+		t.Fatalf("switches = %+v; want downgrade to HTTPS then upgrade to HTTP/2", switches)
+	}
+	if lastProto != protoHTTP2 {
+		t.Errorf("last probe ran on %s; want HTTP/2", protoNames[lastProto])
+	}
+}
+
+func TestRunTarget_UpgradesToAdvertisedH3(t *testing.T) {
+	// The TLS server advertises an HTTP/3 endpoint on a different port
+	var h3Requests atomic.Int32
+	h3srv := &http3.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h3Requests.Add(1)
+	})}
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = udp.Close() }()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%d"; ma=60`, udp.LocalAddr().(*net.UDPAddr).Port))
+	}))
+	srv.StartTLS()
+	defer srv.Close()
+	h3srv.TLSConfig = http3.ConfigureTLSConfig(srv.TLS)
+	go func() { _ = h3srv.Serve(udp) }()
+	defer func() { _ = h3srv.Close() }()
+
+	o := &options{timeout: 5 * time.Second, count: 6, insecure: true, upgradeH3: true, ctl: newControls(20 * time.Millisecond)}
+	results := runProbes(t, srv.Listener.Addr().String(), protoHTTPS, o)
+
+	var switches []result
+	var lastProto int
+	for _, r := range results {
+		if r.switched {
+			switches = append(switches, r)
+			continue
+		}
+		if r.err != nil {
+			t.Errorf("probe %d on %s: %v", r.seq, protoNames[r.proto], r.err)
+		}
+		lastProto = r.proto
+	}
+	if len(switches) != 1 || !switches[0].advertised || switches[0].proto != protoHTTP3 || switches[0].from != protoHTTPS {
+		t.Fatalf("switches = %+v; want one advertised upgrade to HTTP/3", switches)
+	}
+	if lastProto != protoHTTP3 || h3Requests.Load() < 2 {
+		t.Errorf("last probe on %s, %d HTTP/3 requests; want HTTP/3 probes on the advertised port", protoNames[lastProto], h3Requests.Load())
+	}
+}
+
+func TestRunTarget_FixedCadence(t *testing.T) {
+	// The second request hangs; later ones answer at once
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) == 2 {
+			time.Sleep(400 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		inFlight int
+		fast     bool // later probes start on schedule
+	}{
+		{"serial", 1, false},
+		{"concurrent", 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n.Store(0)
+			o := &options{timeout: 5 * time.Second, count: 6, maxInFlight: tt.inFlight, ctl: newControls(50 * time.Millisecond)}
+			got := runProbes(t, srv.Listener.Addr().String(), protoHTTP1, o)
+			if len(got) != 6 {
+				t.Fatalf("%d results; want 6", len(got))
+			}
+			for i, r := range got {
+				if r.seq != i+1 || r.err != nil {
+					t.Errorf("result %d: seq %d, err %v; want seq %d in order", i, r.seq, r.err, i+1)
+				}
+			}
+			// Six starts 50ms apart span 250ms; waiting out the slow
+			// response adds its 400ms
+			span := got[5].at.Sub(got[0].at)
+			if fast := span < 500*time.Millisecond; fast != tt.fast {
+				t.Errorf("probes 1-6 started over %v; want on schedule = %v", span, tt.fast)
+			}
+		})
+	}
+}
+
+func TestRunTarget_WarmupOnTopOfCount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	o := &options{timeout: 5 * time.Second, count: 3, warmup: 2, ctl: newControls(time.Millisecond)}
+	results := runProbes(t, srv.Listener.Addr().String(), protoHTTP1, o)
+	var warm []bool
+	for _, r := range results {
+		warm = append(warm, r.warmup)
+	}
+	if fmt.Sprint(warm) != "[true true false false false]" {
+		t.Errorf("warmup flags = %v; want 2 warmup probes, then -c 3 measured ones", warm)
+	}
+}
+
+func TestRunTarget_DowngradeSearchKeepsCadence(t *testing.T) {
+	// HTTP/2 always fails; HTTP/1.1 over TLS works but takes 300ms, so the
+	// downgrade search is slow
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			panic(http.ErrAbortHandler)
+		}
+		time.Sleep(300 * time.Millisecond)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	o := &options{timeout: 5 * time.Second, count: 10, maxInFlight: 4, insecure: true, canDowngrade: true, minProto: protoHTTPS,
+		downAfter: 2, ctl: newControls(20 * time.Millisecond)}
+	results := runProbes(t, srv.Listener.Addr().String(), protoHTTP2, o)
+	before, switched := 0, false
+	for _, r := range results {
+		if r.switched {
+			switched = true
+		} else if !switched {
+			before++
+		}
+	}
+	if !switched {
+		t.Fatal("no downgrade")
+	}
+	if before < 6 {
+		t.Errorf("%d probes reported before the downgrade; want the cadence to continue during the search", before)
+	}
+}
+
+func TestRunTarget_HandlesResultsWhilePaused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	o := &options{timeout: 5 * time.Second, count: 3, maxInFlight: 1, ctl: newControls(10 * time.Millisecond)}
+	results := startProbes(t, srv.Listener.Addr().String(), protoHTTP1, o)
+	time.Sleep(30 * time.Millisecond) // the first probe is in flight
+	o.ctl.togglePause()
+
+	select {
+	case r := <-results:
+		if r.seq != 1 {
+			t.Errorf("got seq %d while paused; want the in-flight probe 1", r.seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight probe not reported while paused")
+	}
+	select {
+	case r := <-results:
+		t.Fatalf("probe %d started while paused", r.seq)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	o.ctl.togglePause()
+	n := 1
+	for range results {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("%d results after resume; want 3 in total", n)
+	}
+}
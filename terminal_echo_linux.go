@@ -34,6 +34,12 @@ func disableInputProcessing() func() {
 	}
 }
 
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	return err == nil
+}
+
 // handleSuspendResume handles Ctrl-Z (SIGTSTP) by restoring the terminal
 // before suspending and re-applying settings on resume (SIGCONT).
 // Holds displayMu across the suspend/resume cycle so the main loop
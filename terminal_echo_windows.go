@@ -2,10 +2,49 @@
 
 package main
 
-// disableInputProcessing is a no-op on Windows; the console does not
-// process input control characters in the same way Unix terminals do.
+import (
+	"os"
+	"unsafe"
+)
+
+var (
+	procGetConsoleMode = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+)
+
+// Console input mode flags
+const (
+	enableLineInput = 0x0002
+	enableEchoInput = 0x0004
+)
+
+func getConsoleMode(f *os.File) (uint32, bool) {
+	var mode uint32
+	r, _, _ := procGetConsoleMode.Call(f.Fd(), uintptr(unsafe.Pointer(&mode)))
+	return mode, r != 0
+}
+
+// disableInputProcessing turns off line buffering and echo on the console
+// so single keypresses can be read. Processed input stays enabled so
+// Ctrl+C still works. Returns a function to restore the original mode.
 func disableInputProcessing() func() {
-	return func() {}
+	handle := os.Stdin.Fd()
+	old, ok := getConsoleMode(os.Stdin)
+	if !ok {
+		return func() {}
+	}
+	if r, _, _ := procSetConsoleMode.Call(handle, uintptr(old&^(enableLineInput|enableEchoInput))); r == 0 {
+		return func() {}
+	}
+	return func() {
+		_, _, _ = procSetConsoleMode.Call(handle, uintptr(old))
+	}
+}
+
+// isTerminal reports whether f is a console.
+func isTerminal(f *os.File) bool {
+	_, ok := getConsoleMode(f)
+	return ok
 }
 
 // handleSuspendResume is a no-op on Windows (no SIGTSTP/SIGCONT).
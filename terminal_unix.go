@@ -3,12 +3,27 @@
 package main
 
 import (
+	"os"
+	"os/signal"
 	"syscall"
 	"unsafe"
 )
 
 // getTermWidth returns terminal width, defaulting to 80
 func getTermWidth() int {
+	if cols, _ := termSize(); cols != 0 {
+		return cols
+	}
+	return 80
+}
+
+// getTermHeight returns the terminal height in rows, or 0 if unknown
+func getTermHeight() int {
+	_, rows := termSize()
+	return rows
+}
+
+func termSize() (cols, rows int) {
 	type winsize struct {
 		Row, Col, Xpixel, Ypixel uint16
 	}
@@ -17,8 +32,25 @@ func getTermWidth() int {
 		uintptr(syscall.Stdout),
 		uintptr(syscall.TIOCGWINSZ),
 		uintptr(unsafe.Pointer(&ws)))
-	if ws.Col == 0 {
-		return 80
-	}
-	return int(ws.Col)
+	return int(ws.Col), int(ws.Row)
+}
+
+// watchResize calls redraw, with displayMu held, whenever SIGWINCH
+// reports a new terminal size.
+func watchResize(redraw func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	go func() {
+		width, height := getTermWidth(), getTermHeight()
+		for range ch {
+			w, h := getTermWidth(), getTermHeight()
+			if w == width && h == height {
+				continue
+			}
+			width, height = w, h
+			displayMu.Lock()
+			redraw()
+			displayMu.Unlock()
+		}
+	}()
 }
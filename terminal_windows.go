@@ -4,6 +4,7 @@ package main
 
 import (
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -30,14 +31,46 @@ type consoleScreenBufferInfo struct {
 
 // getTermWidth returns terminal width, defaulting to 80
 func getTermWidth() int {
+	info, ok := consoleInfo()
+	if !ok {
+		return 80
+	}
+	return int(info.window.right - info.window.left + 1)
+}
+
+// getTermHeight returns the console window height in rows, or 0 if unknown
+func getTermHeight() int {
+	info, ok := consoleInfo()
+	if !ok {
+		return 0
+	}
+	return int(info.window.bottom - info.window.top + 1)
+}
+
+func consoleInfo() (consoleScreenBufferInfo, bool) {
 	var info consoleScreenBufferInfo
 	handle, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
 	if err != nil {
-		return 80
+		return info, false
 	}
 	r, _, _ := procGetConsoleScreenBufferInfo.Call(uintptr(handle), uintptr(unsafe.Pointer(&info)))
-	if r == 0 {
-		return 80
-	}
-	return int(info.window.right - info.window.left + 1)
+	return info, r != 0
+}
+
+// watchResize calls redraw, with displayMu held, whenever the console
+// size changes. Windows has no SIGWINCH, so the size is polled.
+func watchResize(redraw func()) {
+	go func() {
+		width, height := getTermWidth(), getTermHeight()
+		for range time.Tick(250 * time.Millisecond) {
+			w, h := getTermWidth(), getTermHeight()
+			if w == width && h == height {
+				continue
+			}
+			width, height = w, h
+			displayMu.Lock()
+			redraw()
+			displayMu.Unlock()
+		}
+	}()
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// tlsSettings are the TLS flags. One *tls.Config built from them is
+// shared by the TCP and QUIC transports.
+type tlsSettings struct {
+	insecure bool   // skip certificate verification
+	caFile   string // PEM bundle replacing the system roots
+	certFile string // client certificate (PEM) for mutual TLS
+	keyFile  string // its private key ("" = in certFile)
+	min, max string // "1.0" .. "1.3" ("" = Go's default)
+	sni      string // server name to send and verify ("" = URL host)
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig builds the client TLS configuration, loading the CA bundle
+// and client key pair up front so a bad path fails at startup.
+func newTLSConfig(ts tlsSettings) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: ts.insecure, ServerName: ts.sni}
+	if ts.caFile != "" {
+		pem, err := os.ReadFile(ts.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("--cacert: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("--cacert: no PEM certificates in %s", ts.caFile)
+		}
+	}
+	if ts.keyFile != "" && ts.certFile == "" {
+		return nil, errors.New("--key needs --cert")
+	}
+	if ts.certFile != "" {
+		keyFile := ts.keyFile
+		if keyFile == "" {
+			keyFile = ts.certFile
+		}
+		cert, err := tls.LoadX509KeyPair(ts.certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("--cert/--key: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	var ok bool
+	if ts.min != "" {
+		if cfg.MinVersion, ok = tlsVersions[ts.min]; !ok {
+			return nil, fmt.Errorf("--tls-min: unknown TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", ts.min)
+		}
+	}
+	if ts.max != "" {
+		if cfg.MaxVersion, ok = tlsVersions[ts.max]; !ok {
+			return nil, fmt.Errorf("--tls-max: unknown TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", ts.max)
+		}
+	}
+	if cfg.MinVersion != 0 && cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return nil, fmt.Errorf("--tls-min %s is above --tls-max %s", ts.min, ts.max)
+	}
+	return cfg, nil
+}
+
+// tlsConfig returns a copy of the shared TLS configuration for a new
+// transport (options built without one, e.g. in tests, only honour -k).
+func (o *options) tlsConfig() *tls.Config {
+	if o.tls == nil {
+		return &tls.Config{InsecureSkipVerify: o.insecure}
+	}
+	return o.tls.Clone()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// =============================================================================
+// Test: TLS settings (--cacert, --cert/--key, --tls-min/--tls-max, --sni)
+// =============================================================================
+
+// testCert issues a certificate signed by parent (self-signed if nil) and
+// writes it and its key as PEM files into dir.
+func testCert(t *testing.T, dir, name string, tmpl *x509.Certificate, parent *tls.Certificate) (tls.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.Subject = pkix.Name{CommonName: name}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := tmpl, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+func TestTLSConfig_PrivateCAAndClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile, _ := testCert(t, dir, "ca", &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	server, _, _ := testCert(t, dir, "server", &x509.Certificate{DNSNames: []string{"internal.test"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	_, clientCert, clientKey := testCert(t, dir, "client", &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+
+	// The servers only accept clients signed by the private CA
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{server}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = serverTLS
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // rejected handshakes are expected
+	srv.StartTLS()
+	defer srv.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = udp.Close() }()
+	h3srv := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(serverTLS)}
+	go func() { _ = h3srv.Serve(udp) }()
+	defer func() { _ = h3srv.Close() }()
+
+	urls := map[int]string{
+		protoHTTPS: "https://" + srv.Listener.Addr().String(),
+		protoHTTP3: "https://" + udp.LocalAddr().String(),
+	}
+	tests := []struct {
+		name    string
+		ts      tlsSettings
+		wantErr string // "" = both protocols connect
+	}{
+		{"ca, client cert and sni", tlsSettings{caFile: caFile, certFile: clientCert, keyFile: clientKey, sni: "internal.test"}, ""},
+		{"no client cert", tlsSettings{caFile: caFile, sni: "internal.test"}, "certificate"},
+		{"system roots", tlsSettings{certFile: clientCert, keyFile: clientKey, sni: "internal.test"}, "certificate"},
+		{"no sni", tlsSettings{caFile: caFile, certFile: clientCert, keyFile: clientKey}, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := newTLSConfig(tt.ts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o := &options{timeout: 5 * time.Second, tls: cfg}
+			for proto, url := range urls {
+				_, err := measureRTT(createClient(proto, o), url, proto, nil)
+				if tt.wantErr == "" && err != nil {
+					t.Errorf("%s: %v", protoNames[proto], err)
+				}
+				if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+					t.Errorf("%s: err = %v; want one mentioning %q", protoNames[proto], err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig_Settings(t *testing.T) {
+	dir := t.TempDir()
+	_, certFile, keyFile := testCert(t, dir, "client", &x509.Certificate{}, nil)
+	both := filepath.Join(dir, "both.pem")
+	certPEM, _ := os.ReadFile(certFile)
+	keyPEM, _ := os.ReadFile(keyFile)
+	_ = os.WriteFile(both, append(certPEM, keyPEM...), 0o600)
+
+	cfg, err := newTLSConfig(tlsSettings{certFile: both, min: "1.2", max: "1.3", sni: "example.com", insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Certificates) != 1 || cfg.MinVersion != tls.VersionTLS12 || cfg.MaxVersion != tls.VersionTLS13 || cfg.ServerName != "example.com" || !cfg.InsecureSkipVerify {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	tests := []struct {
+		name    string
+		ts      tlsSettings
+		wantErr string
+	}{
+		{"missing ca", tlsSettings{caFile: filepath.Join(dir, "nope.pem")}, "--cacert"},
+		{"ca without certs", tlsSettings{caFile: keyFile}, "no PEM certificates"},
+		{"key without cert", tlsSettings{keyFile: keyFile}, "--key needs --cert"},
+		{"cert without key", tlsSettings{certFile: certFile}, "--cert/--key"},
+		{"bad version", tlsSettings{min: "1.4"}, "--tls-min"},
+		{"min above max", tlsSettings{min: "1.3", max: "1.2"}, "above"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTLSConfig(tt.ts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newTLSConfig = %v; want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
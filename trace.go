@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// phases breaks a request's RTT into its connection stages. A zero field
+// means the stage did not happen (no DNS for IP literals, no TLS for plain
+// HTTP). ttfb runs from connection ready to the first response byte, so
+// the four fields roughly add up to the total RTT. reused is set when the
+// request ran on an existing (keep-alive) connection.
+type phases struct {
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+	ttfb    time.Duration
+	reused  bool
+}
+
+// add returns the field-wise sum of p and q (reused is not carried).
+func (p phases) add(q phases) phases {
+	return phases{dns: p.dns + q.dns, connect: p.connect + q.connect, tls: p.tls + q.tls, ttfb: p.ttfb + q.ttfb}
+}
+
+// div returns p with every field divided by n (n must be > 0).
+func (p phases) div(n int) phases {
+	d := time.Duration(n)
+	return phases{dns: p.dns / d, connect: p.connect / d, tls: p.tls / d, ttfb: p.ttfb / d}
+}
+
+// Colors for each phase in the stacked-bar view
+var phaseColors = [4]string{cyan, blue, magenta, yellow}
+
+var phaseLabels = [4]string{"dns", "tcp", "tls", "ttfb"}
+
+// values returns the phases in display order.
+func (p phases) values() [4]time.Duration {
+	return [4]time.Duration{p.dns, p.connect, p.tls, p.ttfb}
+}
+
+// phaseTracer records phase timestamps from httptrace callbacks. Callbacks
+// can fire from several goroutines (e.g. Happy Eyeballs dials), so all
+// access goes through mu.
+type phaseTracer struct {
+	mu                  sync.Mutex
+	dnsStart, dnsDone   time.Time
+	connStart, connDone time.Time
+	tlsStart, tlsDone   time.Time
+	gotConn, firstByte  time.Time
+	reused              bool
+	remote              net.Addr // peer of the connection used
+}
+
+func (pt *phaseTracer) trace() *httptrace.ClientTrace {
+	// mark stores now into *t only the first time, keeping the earliest
+	// start and the first completed dial.
+	mark := func(t *time.Time) {
+		pt.mu.Lock()
+		if t.IsZero() {
+			*t = time.Now()
+		}
+		pt.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { mark(&pt.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { mark(&pt.dnsDone) },
+		ConnectStart:         func(string, string) { mark(&pt.connStart) },
+		TLSHandshakeStart:    func() { mark(&pt.tlsStart) },
+		GotFirstResponseByte: func() { mark(&pt.firstByte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			mark(&pt.gotConn)
+			pt.mu.Lock()
+			pt.reused = info.Reused
+			if info.Conn != nil {
+				pt.remote = info.Conn.RemoteAddr()
+			}
+			pt.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				mark(&pt.connDone)
+			}
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				mark(&pt.tlsDone)
+			}
+		},
+	}
+}
+
+// phases converts the recorded timestamps into durations.
+func (pt *phaseTracer) phases() phases {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	span := func(start, end time.Time) time.Duration {
+		if start.IsZero() || end.IsZero() || end.Before(start) {
+			return 0
+		}
+		return end.Sub(start)
+	}
+	p := phases{
+		dns:     span(pt.dnsStart, pt.dnsDone),
+		connect: span(pt.connStart, pt.connDone),
+		tls:     span(pt.tlsStart, pt.tlsDone),
+		ttfb:    span(pt.gotConn, pt.firstByte),
+		reused:  pt.reused,
+	}
+	// QUIC performs the transport and TLS handshakes together, so the TLS
+	// span sits inside the connect span. Count the overlap only once.
+	if p.tls > 0 && pt.tlsStart.Before(pt.connDone) {
+		p.connect = max(p.connect-p.tls, 0)
+	}
+	return p
+}
+
+// remoteIP returns the IP of the connection the request ran on, or "" if
+// none was reported.
+func (pt *phaseTracer) remoteIP() string {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.remote == nil {
+		return ""
+	}
+	ap, err := netip.ParseAddrPort(pt.remote.String())
+	if err != nil {
+		return ""
+	}
+	return ap.Addr().Unmap().WithZone("").String()
+}
+
+// formatPhases returns a compact textual breakdown such as
+// "dns 0.4 tcp 12 tls 25 ttfb 40ms". Stages that did not happen are
+// omitted; sub-millisecond ones keep a decimal so they don't read as 0.
+func formatPhases(p phases) string {
+	var parts []string
+	for i, d := range p.values() {
+		if d > 0 || i == 3 {
+			parts = append(parts, phaseLabels[i]+" "+phaseMs(d))
+		}
+	}
+	return strings.Join(parts, " ") + "ms"
+}
+
+// phaseMs formats a phase in milliseconds: whole numbers from 1ms, one
+// decimal below, and "<0.1" for anything shorter that still happened.
+func phaseMs(d time.Duration) string {
+	switch {
+	case d <= 0 || d >= time.Millisecond:
+		return fmt.Sprintf("%d", d.Milliseconds())
+	case d < 100*time.Microsecond:
+		return "<0.1"
+	}
+	return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+}
+
+// phaseBar renders p as a stacked horizontal bar of the given width, one
+// color per phase. Every non-zero phase gets at least one column.
+func phaseBar(p phases, width int) string {
+	vals := p.values()
+	var total time.Duration
+	for _, d := range vals {
+		total += d
+	}
+	if total <= 0 || width <= 0 {
+		return ""
+	}
+	last := 0
+	for i, d := range vals {
+		if d > 0 {
+			last = i
+		}
+	}
+	var b strings.Builder
+	used := 0
+	for i, d := range vals {
+		if d <= 0 {
+			continue
+		}
+		n := max(int(int64(width)*int64(d)/int64(total)), 1)
+		if i == last {
+			// Last segment absorbs rounding so the bar fills the width
+			n = width - used
+		}
+		n = min(n, width-used)
+		if n <= 0 {
+			continue
+		}
+		b.WriteString(phaseColors[i] + strings.Repeat("█", n) + reset)
+		used += n
+	}
+	return b.String()
+}
+
+// phaseLegend returns the color key for phaseBar.
+func phaseLegend() string {
+	var parts []string
+	for i, l := range phaseLabels {
+		parts = append(parts, phaseColors[i]+"█"+reset+gray+l+reset)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// Test: phase timing helpers
+// =============================================================================
+
+func TestFormatPhases(t *testing.T) {
+	tests := []struct {
+		name string
+		p    phases
+		want string
+	}{
+		{"all", phases{dns: 3 * time.Millisecond, connect: 12 * time.Millisecond, tls: 25 * time.Millisecond, ttfb: 40 * time.Millisecond}, "dns 3 tcp 12 tls 25 ttfb 40ms"},
+		{"ip-literal-plain-http", phases{connect: 5 * time.Millisecond, ttfb: 9 * time.Millisecond}, "tcp 5 ttfb 9ms"},
+		{"empty", phases{}, "ttfb 0ms"},
+		{"sub-millisecond", phases{dns: 300 * time.Microsecond, connect: 40 * time.Microsecond, ttfb: 1500 * time.Microsecond}, "dns 0.3 tcp <0.1 ttfb 1ms"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatPhases(tc.p); got != tc.want {
+				t.Errorf("formatPhases() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPhaseBar(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     phases
+		width int
+		want  int // visible width
+	}{
+		{"even", phases{dns: 10, connect: 10, tls: 10, ttfb: 10}, 20, 20},
+		{"tiny-phase-still-visible", phases{dns: 1, ttfb: 1000}, 10, 10},
+		{"empty", phases{}, 20, 0},
+		{"zero-width", phases{dns: 10, connect: 10, tls: 10, ttfb: 10}, 0, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := phaseBar(tc.p, tc.width)
+			if n := strings.Count(got, "█"); n != tc.want {
+				t.Errorf("phaseBar() width = %d; want %d", n, tc.want)
+			}
+		})
+	}
+
+	// A phase shorter than one column still gets its color
+	if got := phaseBar(phases{dns: 1, ttfb: 1000}, 10); !strings.HasPrefix(got, cyan+"█") {
+		t.Errorf("phaseBar() = %q; want leading dns segment", got)
+	}
+}
+
+func TestFormatStats_PhaseBarNeedsColor(t *testing.T) {
+	s := &stats{phaseBar: true, count: 1, lastPhases: phases{dns: 10, connect: 10, tls: 10, ttfb: 10}}
+	if got := formatStats(s); !strings.Contains(got, "█") {
+		t.Errorf("formatStats() = %q; want phase bar with color", got)
+	}
+	setColor(false)
+	defer setColor(true)
+	got := formatStats(s)
+	if strings.Contains(got, "█") || !strings.Contains(got, formatPhases(s.lastPhases)) {
+		t.Errorf("formatStats() = %q; want text phases without color", got)
+	}
+}
+
+func TestPhaseTracer_MeasuresLocalServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	client := createClient(protoHTTP1, &options{timeout: 5 * time.Second})
+	m, err := measureRTT(client, srv.URL, protoHTTP1, nil)
+	if err != nil {
+		t.Fatalf("measureRTT() error = %v", err)
+	}
+	rtt, ph := m.rtt, m.ph
+	if m.status != http.StatusOK {
+		t.Errorf("status = %d; want 200", m.status)
+	}
+	if ph.connect <= 0 {
+		t.Errorf("connect = %v; want > 0", ph.connect)
+	}
+	if ph.ttfb < 5*time.Millisecond {
+		t.Errorf("ttfb = %v; want >= 5ms (server delay)", ph.ttfb)
+	}
+	if ph.dns != 0 || ph.tls != 0 {
+		t.Errorf("dns/tls = %v/%v; want 0/0 for plain HTTP to an IP", ph.dns, ph.tls)
+	}
+	if sum := ph.dns + ph.connect + ph.tls + ph.ttfb; sum > rtt {
+		t.Errorf("phase sum %v exceeds rtt %v", sum, rtt)
+	}
+}
+
+func TestPhaseTracer_ReportsReusedConnection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	client := createClient(protoHTTP1, &options{timeout: 5 * time.Second, reuse: true})
+	for i, wantReused := range []bool{false, true, true} {
+		m, err := measureRTT(client, srv.URL, protoHTTP1, nil)
+		if err != nil {
+			t.Fatalf("measureRTT() error = %v", err)
+		}
+		if m.ph.reused != wantReused {
+			t.Errorf("request %d: reused = %v; want %v", i+1, m.ph.reused, wantReused)
+		}
+		if wantReused && m.ph.connect != 0 {
+			t.Errorf("request %d: connect = %v on a reused connection; want 0", i+1, m.ph.connect)
+		}
+	}
+}